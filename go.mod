@@ -5,4 +5,7 @@ go 1.25.1
 require (
 	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.10.9
+	golang.org/x/net v0.57.0
 )
+
+require golang.org/x/text v0.40.0 // indirect
@@ -1,17 +1,22 @@
 package cli
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/Nightails/gator/internal/config"
 	"github.com/Nightails/gator/internal/database"
+	"github.com/Nightails/gator/internal/rss"
 )
 
 type state struct {
-	db  *database.Queries
-	cfg *config.Config
+	db      *database.Queries
+	conn    *sql.DB
+	cfg     *config.Config
+	fetcher *rss.Fetcher
 }
 
 type command struct {
@@ -35,8 +40,12 @@ func (c *commands) register(name string, handler func(*state, command) error) {
 	c.cmdMap[name] = handler
 }
 
-func RunCli(cfg *config.Config, db *database.Queries) {
-	s, cmds := setupCli(db, cfg)
+func RunCli(cfg *config.Config, conn *sql.DB) {
+	s, cmds, err := setupCli(conn, cfg)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
 	registerCommands(&cmds)
 
 	args := os.Args
@@ -51,10 +60,28 @@ func RunCli(cfg *config.Config, db *database.Queries) {
 	}
 }
 
-func setupCli(db *database.Queries, cfg *config.Config) (state, commands) {
-	s := state{db: db, cfg: cfg}
+func setupCli(conn *sql.DB, cfg *config.Config) (state, commands, error) {
+	fetcher, err := newFetcher(cfg)
+	if err != nil {
+		return state{}, commands{}, err
+	}
+	s := state{db: database.New(conn), conn: conn, cfg: cfg, fetcher: fetcher}
 	cmds := commands{make(map[string]func(*state, command) error)}
-	return s, cmds
+	return s, cmds, nil
+}
+
+// newFetcher creates the feed fetcher from the HTTP client settings of the config.
+func newFetcher(cfg *config.Config) (*rss.Fetcher, error) {
+	return rss.NewFetcher(rss.FetcherOptions{
+		Timeout:      time.Duration(cfg.FetchTimeoutSeconds) * time.Second,
+		ProxyURL:     cfg.ProxyURL,
+		UserAgent:    cfg.UserAgent,
+		MaxRedirects: cfg.MaxRedirects,
+		Retries:      cfg.FetchRetries,
+		MaxBytes:     cfg.MaxFeedBytes,
+		HostRate:     cfg.HostRateLimit,
+		HostBurst:    cfg.HostBurst,
+	})
 }
 
 func registerCommands(cmds *commands) {
@@ -65,8 +92,11 @@ func registerCommands(cmds *commands) {
 	cmds.register("agg", handlerAgg)
 	cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
 	cmds.register("feeds", handlerFeeds)
+	cmds.register("feed", handlerFeed)
 	cmds.register("follow", middlewareLoggedIn(handlerFollow))
 	cmds.register("following", middlewareLoggedIn(handlerFollowing))
 	cmds.register("unfollow", middlewareLoggedIn(handlerUnFollow))
 	cmds.register("browse", middlewareLoggedIn(handlerBrowse))
+	cmds.register("enclosures", middlewareLoggedIn(handlerEnclosures))
+	cmds.register("import", middlewareLoggedIn(handlerImport))
 }
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the layouts parseTime tries, in order, once the date has been normalized.
+// Day numbers may have one or two digits, and fractional seconds are accepted after the seconds field.
+var dateLayouts = []string{
+	// RFC 822 and RFC 1123, with the weekday removed
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -07:00",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04 -0700",
+	"2 January 2006",
+	"2 Jan 2006",
+	"January 2, 2006 15:04:05 -0700",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"Jan 2 15:04:05 2006", // ANSI C
+	// ISO 8601 and W3CDTF
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// zoneOffsets maps the zone abbreviations found in feeds to their UTC offsets.
+// time.Parse only knows the abbreviations of the local zone and reads the others as UTC.
+var zoneOffsets = map[string]string{
+	"UT": "+0000", "UTC": "+0000", "GMT": "+0000", "Z": "+0000",
+	"EST": "-0500", "EDT": "-0400", "CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600", "PST": "-0800", "PDT": "-0700",
+	"AKST": "-0900", "AKDT": "-0800", "HST": "-1000",
+	"WET": "+0000", "WEST": "+0100", "BST": "+0100", "CET": "+0100", "CEST": "+0200",
+	"EET": "+0200", "EEST": "+0300", "MSK": "+0300",
+	"JST": "+0900", "KST": "+0900", "AWST": "+0800", "ACST": "+0930",
+	"AEST": "+1000", "AEDT": "+1100", "NZST": "+1200", "NZDT": "+1300",
+}
+
+var (
+	weekdayPrefix = regexp.MustCompile(`(?i)^(mon|tue|wed|thu|fri|sat|sun)[a-z]*\.?,?\s+`)
+	zoneComment   = regexp.MustCompile(`\s*\([^)]*\)$`)
+	namedZone     = regexp.MustCompile(`(\d:\d\d(?:\.\d+)?)\s+([A-Za-z]{1,5})$`)
+	isoWeekDate   = regexp.MustCompile(`^(\d{4})-?W(\d{2})(?:-?([1-7]))?$`)
+)
+
+// parseTime parses a feed date into a time.Time. Besides the usual RFC 822 and ISO 8601 forms it accepts
+// single-digit days, named zones, missing seconds and ISO week dates. Unknown zone names are read as UTC.
+func parseTime(dateStr string) (time.Time, error) {
+	value := normalizeDate(dateStr)
+	if value == "" {
+		return time.Time{}, errors.New("missing date")
+	}
+	if t, ok := parseISOWeek(value); ok {
+		return t, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("failed to parse date: %s", dateStr)
+}
+
+// normalizeDate collapses whitespace, drops the weekday and zone comments, and replaces a zone name
+// following the time with its numeric offset.
+func normalizeDate(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	value = weekdayPrefix.ReplaceAllString(value, "")
+	value = zoneComment.ReplaceAllString(value, "")
+	value = strings.Replace(value, "Sept ", "Sep ", 1)
+
+	if match := namedZone.FindStringSubmatchIndex(value); match != nil {
+		zone := strings.ToUpper(value[match[4]:match[5]])
+		offset, ok := zoneOffsets[zone]
+		if !ok {
+			offset = "+0000"
+		}
+		value = value[:match[3]] + " " + offset
+	}
+	return value
+}
+
+// parseISOWeek parses ISO 8601 week dates such as 2006-W01-1, 2006W011 and 2006-W01 (the Monday of the week).
+func parseISOWeek(value string) (time.Time, bool) {
+	match := isoWeekDate.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, false
+	}
+	year, _ := strconv.Atoi(match[1])
+	week, _ := strconv.Atoi(match[2])
+	day := 1
+	if match[3] != "" {
+		day, _ = strconv.Atoi(match[3])
+	}
+
+	// Week 1 is the week with the year's first Thursday, so it always contains January 4th
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	monday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+	t := monday.AddDate(0, 0, (week-1)*7+day-1)
+	if y, w := t.ISOWeek(); y != year || w != week {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"Mon, 02 Jan 2006 15:04:05 -0700", time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{"Mon, 2 Jan 2006 15:04:05 GMT", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"Mon, 2 Jan 2006 15:04:05 EDT", time.Date(2006, 1, 2, 19, 4, 5, 0, time.UTC)},
+		{"Monday, 2 January 2006 15:04 PST", time.Date(2006, 1, 2, 23, 4, 0, 0, time.UTC)},
+		{"2 Jan 06 15:04 +0100", time.Date(2006, 1, 2, 14, 4, 0, 0, time.UTC)},
+		{"Tue, 5 Sept 2023 08:00:00 +0000 (UTC)", time.Date(2023, 9, 5, 8, 0, 0, 0, time.UTC)},
+		{"Mon,  2 Jan 2006  15:04:05 XYZ", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"January 2, 2006", time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"2006-01-02T15:04:05.123Z", time.Date(2006, 1, 2, 15, 4, 5, 123000000, time.UTC)},
+		{"2006-01-02T15:04+02:00", time.Date(2006, 1, 2, 13, 4, 0, 0, time.UTC)},
+		{"2006-01-02 15:04:05 UTC", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"2006-01-02", time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"2009-W01-1", time.Date(2008, 12, 29, 0, 0, 0, 0, time.UTC)},
+		{"2020W537", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"2024-W10", time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTime(tt.value)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got.UTC())
+			}
+		})
+	}
+
+	t.Run("returns an error for missing and invalid dates", func(t *testing.T) {
+		for _, value := range []string{"", "  ", "yesterday", "2021-W53-1"} {
+			if _, err := parseTime(value); err == nil {
+				t.Errorf("expected error for %q", value)
+			}
+		}
+	})
+}
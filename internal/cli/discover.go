@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Nightails/gator/internal/database"
+	"github.com/Nightails/gator/internal/rss"
+)
+
+// chooseCandidate picks one of the feeds discovered on a website. pick selects a candidate by its 1-based position;
+// when it is 0 a single candidate is picked automatically, and the user is asked to choose among several.
+func chooseCandidate(candidates []rss.Candidate, pick int, in io.Reader, out io.Writer) (rss.Candidate, error) {
+	if pick < 0 || pick > len(candidates) {
+		return rss.Candidate{}, fmt.Errorf("--pick must be between 1 and %d", len(candidates))
+	}
+	if pick > 0 {
+		return candidates[pick-1], nil
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+
+	_, _ = fmt.Fprintln(out, "found several feeds:")
+	for i, candidate := range candidates {
+		_, _ = fmt.Fprintf(out, "%d. %s (%s)\n", i+1, cmp.Or(candidate.Title, "untitled"), candidate.URL)
+	}
+	_, _ = fmt.Fprintf(out, "pick a feed [1-%d]: ", len(candidates))
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return rss.Candidate{}, errors.New("no feed picked, pass --pick to choose one")
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return rss.Candidate{}, fmt.Errorf("invalid choice: %q", strings.TrimSpace(line))
+	}
+	return candidates[choice-1], nil
+}
+
+// feedForURL returns the feed with the given url, or a url it moved from. When there is none, the url may be
+// a website: the first feed discovered on it that is already in the database is returned.
+func feedForURL(ctx context.Context, s *state, feedURL string) (database.Feed, error) {
+	feed, err := s.db.GetFeedByURL(ctx, feedURL)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return feed, err
+	}
+	candidates, err := s.fetcher.Discover(ctx, feedURL)
+	if err != nil {
+		return database.Feed{}, err
+	}
+	for _, candidate := range candidates {
+		if feed, err := s.db.GetFeedByURL(ctx, candidate.URL); err == nil {
+			return feed, nil
+		}
+	}
+	return database.Feed{}, rss.ErrNoFeedsFound
+}
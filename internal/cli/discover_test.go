@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Nightails/gator/internal/rss"
+)
+
+func TestChooseCandidate(t *testing.T) {
+	candidates := []rss.Candidate{
+		{URL: "https://example.com/feed.xml", Title: "Posts"},
+		{URL: "https://example.com/comments.xml", Title: "Comments"},
+	}
+
+	t.Run("picks a single candidate without asking", func(t *testing.T) {
+		got, err := chooseCandidate(candidates[:1], 0, strings.NewReader(""), io.Discard)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got.URL != candidates[0].URL {
+			t.Errorf("expected %q, got %q", candidates[0].URL, got.URL)
+		}
+	})
+
+	t.Run("uses --pick", func(t *testing.T) {
+		got, err := chooseCandidate(candidates, 2, strings.NewReader(""), io.Discard)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got.URL != candidates[1].URL {
+			t.Errorf("expected %q, got %q", candidates[1].URL, got.URL)
+		}
+		if _, err := chooseCandidate(candidates, 3, strings.NewReader(""), io.Discard); err == nil {
+			t.Error("expected error for out of range --pick")
+		}
+	})
+
+	t.Run("prompts among several candidates", func(t *testing.T) {
+		var out strings.Builder
+		got, err := chooseCandidate(candidates, 0, strings.NewReader("2\n"), &out)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got.URL != candidates[1].URL {
+			t.Errorf("expected %q, got %q", candidates[1].URL, got.URL)
+		}
+		if !strings.Contains(out.String(), "1. Posts (https://example.com/feed.xml)") {
+			t.Errorf("expected candidates to be listed, got %q", out.String())
+		}
+	})
+
+	t.Run("returns an error without an answer", func(t *testing.T) {
+		for _, input := range []string{"", "x\n", "5\n"} {
+			if _, err := chooseCandidate(candidates, 0, strings.NewReader(input), io.Discard); err == nil {
+				t.Errorf("expected error for input %q", input)
+			}
+		}
+	})
+}
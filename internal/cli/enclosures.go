@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Nightails/gator/internal/rss"
+	"github.com/google/uuid"
+)
+
+// partialSuffix is appended to the name of a file while it is being downloaded.
+const partialSuffix = ".part"
+
+// downloadEnclosure fetches mediaURL into dest with the fetcher's HTTP settings and returns the size of the file.
+// The file is written to dest+partialSuffix first, and a partial file left by an interrupted download
+// is resumed with a range request when the server supports it.
+func downloadEnclosure(ctx context.Context, fetcher *rss.Fetcher, mediaURL, dest string) (int64, error) {
+	partial := dest + partialSuffix
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", mediaURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := fetcher.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && contentRangeStart(resp.Header.Get("Content-Range")) == offset:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the partial file already holds the whole body
+		if err := os.Rename(partial, dest); err != nil {
+			return 0, err
+		}
+		return offset, nil
+	case resp.StatusCode == http.StatusOK:
+		// the server ignored the range, start over
+		flags |= os.O_TRUNC
+		offset = 0
+	default:
+		return 0, fmt.Errorf("failed to download enclosure: %s", resp.Status)
+	}
+
+	file, err := os.OpenFile(partial, flags, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		return 0, err
+	}
+	return offset + written, nil
+}
+
+// contentRangeStart returns the first byte position of a "bytes start-end/size" Content-Range header, or -1.
+func contentRangeStart(header string) int64 {
+	var start, end int64
+	if _, err := fmt.Sscanf(header, "bytes %d-%d", &start, &end); err != nil {
+		return -1
+	}
+	return start
+}
+
+// enclosurePath returns where the enclosure is saved: a directory per feed, and a file named after the start
+// of the enclosure id and the file in the URL. The id keeps episodes whose URLs end with the same name apart,
+// including their partial files, and lets an interrupted download find its partial file again.
+func enclosurePath(dir, feedName string, id uuid.UUID, mediaURL string) (string, error) {
+	name := id.String()[:8]
+	if u, err := url.Parse(mediaURL); err == nil {
+		if base := sanitizeFileName(strings.Trim(path.Base(u.Path), "/")); base != "" {
+			name += "-" + base
+		}
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	feedDir := filepath.Join(dir, sanitizeFileName(feedName))
+	if err := os.MkdirAll(feedDir, 0o755); err != nil {
+		return "", err
+	}
+	return filepath.Join(feedDir, name), nil
+}
+
+// sanitizeFileName replaces the characters that are not safe in file names on common file systems.
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < ' ', strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.Trim(strings.TrimSpace(name), ".")
+}
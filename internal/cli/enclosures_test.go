@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nightails/gator/internal/rss"
+)
+
+func TestDownloadEnclosure(t *testing.T) {
+	body := []byte(strings.Repeat("episode audio ", 100))
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		http.ServeContent(w, r, "episode.mp3", time.Time{}, bytes.NewReader(body))
+	}))
+	defer server.Close()
+	fetcher, err := rss.NewFetcher(rss.FetcherOptions{UserAgent: "gator-test/1.0"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("downloads the whole file", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "episode.mp3")
+		size, err := downloadEnclosure(context.Background(), fetcher, server.URL, dest)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if size != int64(len(body)) {
+			t.Errorf("expected size %d, got %d", len(body), size)
+		}
+		assertFileContent(t, dest, body)
+		if userAgent != "gator-test/1.0" {
+			t.Errorf("expected the fetcher's user agent, got %q", userAgent)
+		}
+	})
+
+	t.Run("resumes a partial download", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "episode.mp3")
+		if err := os.WriteFile(dest+partialSuffix, body[:100], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		size, err := downloadEnclosure(context.Background(), fetcher, server.URL, dest)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if size != int64(len(body)) {
+			t.Errorf("expected size %d, got %d", len(body), size)
+		}
+		assertFileContent(t, dest, body)
+		if _, err := os.Stat(dest + partialSuffix); !os.IsNotExist(err) {
+			t.Errorf("expected partial file to be removed, got %v", err)
+		}
+	})
+
+	t.Run("completes a partial download that already holds the whole file", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "episode.mp3")
+		if err := os.WriteFile(dest+partialSuffix, body, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := downloadEnclosure(context.Background(), fetcher, server.URL, dest); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		assertFileContent(t, dest, body)
+	})
+}
+
+func TestEnclosurePath(t *testing.T) {
+	t.Run("names the file after the id and the URL in a directory per feed", func(t *testing.T) {
+		dir := t.TempDir()
+		dest, err := enclosurePath(dir, "My: Podcast", [16]byte{0xab, 0xcd, 0xef, 0x01}, "https://example.com/media/ep1.mp3?src=rss")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if want := filepath.Join(dir, "My_ Podcast", "abcdef01-ep1.mp3"); dest != want {
+			t.Errorf("expected %q, got %q", want, dest)
+		}
+	})
+
+	t.Run("keeps episodes with the same file name apart", func(t *testing.T) {
+		dir := t.TempDir()
+		first, err := enclosurePath(dir, "Podcast", [16]byte{1}, "https://example.com/2024/episode.mp3")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// an interrupted download of the first episode must not be resumed into the second
+		if err := os.WriteFile(first+partialSuffix, []byte("partial"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		second, err := enclosurePath(dir, "Podcast", [16]byte{2}, "https://example.com/2025/episode.mp3")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if first == second {
+			t.Errorf("expected different paths, got %q twice", first)
+		}
+		again, err := enclosurePath(dir, "Podcast", [16]byte{1}, "https://example.com/2024/episode.mp3")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if again != first {
+			t.Errorf("expected the partial file's path %q, got %q", first, again)
+		}
+	})
+
+	t.Run("uses the id when the URL has no file name", func(t *testing.T) {
+		dir := t.TempDir()
+		dest, err := enclosurePath(dir, "Podcast", [16]byte{0xab, 0xcd, 0xef, 0x01}, "https://example.com/")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if want := filepath.Join(dir, "Podcast", "abcdef01"); dest != want {
+			t.Errorf("expected %q, got %q", want, dest)
+		}
+	})
+}
+
+func assertFileContent(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected file %s, got %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected %d bytes of content, got %d", len(want), len(got))
+	}
+}
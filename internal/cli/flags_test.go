@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	t.Run("accepts flags before and after positional arguments", func(t *testing.T) {
+		fs := newFlagSet("agg")
+		workers := fs.Int("workers", 1, "")
+		batch := fs.Int("batch", 0, "")
+
+		args, err := parseFlags(fs, []string{"--workers", "4", "1m", "--batch=10"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !slices.Equal(args, []string{"1m"}) {
+			t.Errorf("expected positional args [1m], got %v", args)
+		}
+		if *workers != 4 {
+			t.Errorf("expected workers 4, got %d", *workers)
+		}
+		if *batch != 10 {
+			t.Errorf("expected batch 10, got %d", *batch)
+		}
+	})
+
+	t.Run("returns an error for unknown flags", func(t *testing.T) {
+		fs := newFlagSet("agg")
+		if _, err := parseFlags(fs, []string{"1m", "--unknown"}); err == nil {
+			t.Fatal("expected error for unknown flag")
+		}
+	})
+}
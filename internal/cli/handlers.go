@@ -2,31 +2,70 @@ package cli
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Nightails/gator/internal/database"
+	"github.com/Nightails/gator/internal/rss"
 	"github.com/google/uuid"
 )
 
 // handlerAddFeed adds a new feed for the current user, stores it in the database, and sets the user to follow the feed.
 // It validates the command arguments, retrieves the current user from the database, creates a feed, and follows it.
 func handlerAddFeed(s *state, cmd command, user database.User) error {
-	if len(cmd.args) < 2 {
+	fs := newFlagSet(cmd.name)
+	pick := fs.Int("pick", 0, "feed to add when the website has several")
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
 		return errors.New("missing feed name and url")
 	}
+	name, feedURL := args[0], args[1]
 
 	ctx := context.Background()
 
+	if existing, err := s.db.GetFeedByURL(ctx, feedURL); err == nil && existing.Url != feedURL {
+		return fmt.Errorf("this feed moved to %s, follow it instead", existing.Url)
+	}
+
+	// the url may be a website rather than its feed
+	candidates, err := s.fetcher.Discover(ctx, feedURL)
+	switch {
+	case errors.Is(err, rss.ErrNoFeedsFound):
+		return fmt.Errorf("no feed found at %s", feedURL)
+	case err != nil:
+		fmt.Printf("could not look for feeds at %s (%v), adding the url as given\n", feedURL, err)
+	default:
+		candidate, err := chooseCandidate(candidates, *pick, os.Stdin, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if candidate.URL != feedURL {
+			fmt.Printf("found feed: %s\n", candidate.URL)
+		}
+		feedURL = candidate.URL
+	}
+	if existing, err := s.db.GetFeedByURL(ctx, feedURL); err == nil {
+		return fmt.Errorf("this feed already exists as %s, follow it instead", existing.Url)
+	}
+
 	// create the feed
 	feedParams := database.CreateFeedParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-		Name:      cmd.args[0],
-		Url:       cmd.args[1],
+		Name:      name,
+		Url:       feedURL,
 		UserID:    user.ID,
 	}
 	feed, err := s.db.CreateFeed(ctx, feedParams)
@@ -55,48 +94,139 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 	return nil
 }
 
-// handlerAgg fetches the RSS feed from the given URL and prints it to the console.
+// handlerAgg periodically scrapes the feeds that are due and saves their posts to the database.
+// With --workers and --batch, each tick claims up to batch feeds and fetches them on that many goroutines.
+// With --once, every due feed is fetched a single time and agg exits; --feed refreshes a single feed and exits.
+// In both one-shot modes a per-feed result table is printed and an error is returned if any feed failed.
 func handlerAgg(s *state, cmd command) error {
-	if len(cmd.args) == 0 {
+	fs := newFlagSet(cmd.name)
+	workers := fs.Int("workers", 1, "number of feeds fetched in parallel")
+	batch := fs.Int("batch", 0, "number of feeds claimed per tick (defaults to --workers)")
+	once := fs.Bool("once", false, "fetch every due feed once and exit")
+	feedURL := fs.String("feed", "", "refresh a single feed and exit")
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+	oneShot := *once || *feedURL != ""
+	if oneShot && len(args) > 0 {
+		return errors.New("too many arguments, --once and --feed do not take a duration")
+	} else if !oneShot && len(args) == 0 {
 		return errors.New("missing duration between fetches")
-	} else if len(cmd.args) > 1 {
+	} else if len(args) > 1 {
 		return errors.New("too many arguments, expected duration between fetches")
 	}
+	if *workers < 1 {
+		return errors.New("workers must be at least 1")
+	}
+	if *batch == 0 {
+		*batch = *workers
+	} else if *batch < 1 {
+		return errors.New("batch must be at least 1")
+	}
+
+	// Stop on Ctrl-C or a service stop, aborting in-flight fetches
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if oneShot {
+		var results []feedResult
+		if *feedURL != "" {
+			feed, err := feedForURL(ctx, s, *feedURL)
+			if err != nil {
+				return errors.New("this feed does not exist")
+			}
+			ctx, cancel := withFeedLease(ctx)
+			defer cancel()
+			feed, err = s.db.ClaimFeedByID(ctx, database.ClaimFeedByIDParams{
+				ID:           feed.ID,
+				LeaseSeconds: int32(feedLease / time.Second),
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				return errors.New("this feed is busy, another aggregator is fetching it")
+			} else if err != nil {
+				return fmt.Errorf("failed to claim feed: %w", err)
+			}
+			results = []feedResult{processFeed(ctx, s, feed)}
+		} else {
+			results, err = scrapeDueFeedsOnce(ctx, s, *batch, *workers)
+			if err != nil {
+				return err
+			}
+		}
+		printResults(results)
+
+		var summary aggSummary
+		summary.count(results)
+		if summary.failed > 0 || summary.aborted > 0 {
+			return fmt.Errorf("%d feeds failed, %d aborted", summary.failed, summary.aborted)
+		}
+		return nil
+	}
 
-	timeBetweenReqs, err := time.ParseDuration(cmd.args[0])
+	timeBetweenReqs, err := time.ParseDuration(args[0])
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Collectingfeeds every %s\n", timeBetweenReqs)
+	fmt.Printf("Collecting %d feeds every %s using %d workers\n", *batch, timeBetweenReqs, *workers)
 
 	ticker := time.NewTicker(timeBetweenReqs)
 	defer ticker.Stop()
 
-	// Run the scrapper immediately on start
-	if err := scrapeFeeds(s); err != nil {
-		return err
-	}
-
-	// Run the scrapper every time the ticker fires
-	for range ticker.C {
-		if err := scrapeFeeds(s); err != nil {
-			return err
+	// Run the scrapper immediately on start, then every time the ticker fires.
+	// Failures are logged and recorded against the feed, they never stop the aggregator.
+	var summary aggSummary
+	for {
+		results, err := scrapeFeeds(ctx, s, *batch, *workers, time.Now())
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		summary.add(results)
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("shutting down")
+			summary.print()
+			return nil
+		case <-ticker.C:
 		}
 	}
-
-	return nil
 }
 
-// handlerFeeds lists all the feeds in the database.
+// handlerFeeds lists all the feeds in the database. With --broken, only failing and disabled feeds are listed,
+// with --orphaned only the feeds nobody follows. "feeds prune" deletes the feeds nobody follows.
 func handlerFeeds(s *state, cmd command) error {
-	if len(cmd.args) > 0 {
+	if len(cmd.args) > 0 && cmd.args[0] == "prune" {
+		return handlerFeedsPrune(s, command{name: cmd.args[0], args: cmd.args[1:]})
+	}
+
+	fs := newFlagSet(cmd.name)
+	broken := fs.Bool("broken", false, "only list failing and disabled feeds")
+	orphaned := fs.Bool("orphaned", false, "only list feeds nobody follows")
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
 		return errors.New("too many arguments")
 	}
+	if *broken && *orphaned {
+		return errors.New("--broken and --orphaned cannot be combined")
+	}
 
-	fmt.Println("listing feeds:")
 	ctx := context.Background()
 
-	feeds, err := s.db.GetFeeds(ctx)
+	var feeds []database.Feed
+	if *broken {
+		fmt.Println("listing broken feeds:")
+		feeds, err = s.db.GetBrokenFeeds(ctx)
+	} else if *orphaned {
+		fmt.Println("listing orphaned feeds:")
+		feeds, err = s.db.GetOrphanedFeeds(ctx)
+	} else {
+		fmt.Println("listing feeds:")
+		feeds, err = s.db.GetFeeds(ctx)
+	}
 	if err != nil {
 		return err
 	}
@@ -110,12 +240,162 @@ func handlerFeeds(s *state, cmd command) error {
 			return err
 		}
 		fmt.Printf("- created by: %s\n", user.Name)
+		if feed.ConsecutiveFailures > 0 {
+			fmt.Printf("- failing: %d consecutive failures, last at %v: %s\n",
+				feed.ConsecutiveFailures, feed.LastErrorAt.Time, feed.LastError.String)
+		}
+		if feed.IntervalOverrideSeconds.Valid {
+			fmt.Printf("- refresh interval: %s (override)\n", time.Duration(feed.IntervalOverrideSeconds.Int32)*time.Second)
+		} else if feed.MinIntervalSeconds.Valid {
+			fmt.Printf("- refresh interval: %s\n", time.Duration(feed.MinIntervalSeconds.Int32)*time.Second)
+		}
+		history, err := s.db.GetFeedURLHistory(ctx, feed.ID)
+		if err != nil {
+			return err
+		}
+		for _, moved := range history {
+			fmt.Printf("- moved from: %s (at %v)\n", moved.Url, moved.CreatedAt)
+		}
+		if feed.DisabledAt.Valid && feed.DisabledReason.Valid {
+			fmt.Printf("- disabled since: %v (%s)\n", feed.DisabledAt.Time, feed.DisabledReason.String)
+		} else if feed.DisabledAt.Valid {
+			fmt.Printf("- disabled since: %v\n", feed.DisabledAt.Time)
+		} else if feed.NextFetchAt.Valid {
+			fmt.Printf("- next fetch after: %v\n", feed.NextFetchAt.Time)
+		}
 		fmt.Println()
 	}
 
 	return nil
 }
 
+// handlerFeedsPrune deletes the feeds that nobody follows, along with their posts.
+func handlerFeedsPrune(s *state, cmd command) error {
+	if len(cmd.args) > 0 {
+		return errors.New("too many arguments")
+	}
+
+	feeds, err := s.db.DeleteOrphanedFeeds(context.Background())
+	if err != nil {
+		return errors.New("failed to prune feeds")
+	}
+	for _, feed := range feeds {
+		fmt.Printf("- removed %s (%s)\n", feed.Name, feed.Url)
+	}
+	fmt.Printf("pruned %d feeds\n", len(feeds))
+	return nil
+}
+
+// handlerFeed manages a single feed. Subcommands:
+//   - enable <url>: re-activate a disabled feed and clear its failures
+//   - set-interval <url> <duration>: override the refresh interval published by the feed, 0 removes the override
+func handlerFeed(s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		return errors.New("missing subcommand")
+	}
+
+	sub := command{name: cmd.args[0], args: cmd.args[1:]}
+	switch sub.name {
+	case "enable":
+		return handlerFeedEnable(s, sub)
+	case "set-interval":
+		return handlerFeedSetInterval(s, sub)
+	default:
+		return fmt.Errorf("unknown feed subcommand: %s", sub.name)
+	}
+}
+
+// handlerFeedEnable re-activates a feed so the aggregator fetches it again.
+func handlerFeedEnable(s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		return errors.New("missing feed url")
+	} else if len(cmd.args) > 1 {
+		return errors.New("too many arguments")
+	}
+
+	ctx := context.Background()
+	feed, err := feedForURL(ctx, s, cmd.args[0])
+	if err != nil {
+		return errors.New("this feed does not exist")
+	}
+	if err := s.db.EnableFeed(ctx, database.EnableFeedParams{
+		ID:        feed.ID,
+		UpdatedAt: time.Now(),
+	}); err != nil {
+		return errors.New("failed to enable feed")
+	}
+
+	fmt.Printf("enabled feed: %s\n", feed.Name)
+	return nil
+}
+
+// parseIntervalOverride parses the interval given to feed set-interval. 0 removes the override, other intervals
+// are stored in whole seconds and must be at least a second.
+func parseIntervalOverride(value string) (time.Duration, error) {
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if interval < 0 {
+		return 0, errors.New("interval must not be negative")
+	}
+	if interval > 0 && interval < time.Second {
+		return 0, errors.New("interval must be at least 1s")
+	}
+	if interval > math.MaxInt32*time.Second {
+		return 0, fmt.Errorf("interval must be at most %s", math.MaxInt32*time.Second)
+	}
+	return interval, nil
+}
+
+// handlerFeedSetInterval overrides how often the aggregator fetches a feed.
+func handlerFeedSetInterval(s *state, cmd command) error {
+	if len(cmd.args) < 2 {
+		return errors.New("missing feed url and interval")
+	} else if len(cmd.args) > 2 {
+		return errors.New("too many arguments")
+	}
+
+	interval, err := parseIntervalOverride(cmd.args[1])
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	feed, err := feedForURL(ctx, s, cmd.args[0])
+	if err != nil {
+		return errors.New("this feed does not exist")
+	}
+
+	params := database.SetFeedIntervalOverrideParams{
+		ID:        feed.ID,
+		UpdatedAt: time.Now(),
+	}
+	if interval > 0 {
+		params.IntervalOverrideSeconds = sql.NullInt32{
+			Int32: int32(interval / time.Second),
+			Valid: true,
+		}
+		// reschedule from the last fetch so the new interval applies right away
+		if feed.LastFetchedAt.Valid {
+			params.NextFetchAt = sql.NullTime{
+				Time:  feed.LastFetchedAt.Time.Add(interval),
+				Valid: true,
+			}
+		}
+	}
+	if err := s.db.SetFeedIntervalOverride(ctx, params); err != nil {
+		return errors.New("failed to set feed interval")
+	}
+
+	if interval > 0 {
+		fmt.Printf("%s will be fetched every %s\n", feed.Name, interval)
+	} else {
+		fmt.Printf("%s will be fetched on its published schedule\n", feed.Name)
+	}
+	return nil
+}
+
 // handlerFollow adds a new feed for the current user, stores it in the database, and sets the user to follow the feed.
 // It validates the command arguments, retrieves the current user from the database, creates a feed, and follows it.
 func handlerFollow(s *state, cmd command, user database.User) error {
@@ -125,7 +405,7 @@ func handlerFollow(s *state, cmd command, user database.User) error {
 
 	ctx := context.Background()
 
-	feed, err := s.db.GetFeedByURL(ctx, cmd.args[0])
+	feed, err := feedForURL(ctx, s, cmd.args[0])
 	if err != nil {
 		return errors.New("this feed does not exist")
 	}
@@ -158,8 +438,21 @@ func handlerFollowing(s *state, cmd command, user database.User) error {
 		return errors.New("unable to retrieve following feeds")
 	}
 
+	categories, err := s.db.GetFeedFollowCategoriesForUser(ctx, user.ID)
+	if err != nil {
+		return errors.New("unable to retrieve following feeds")
+	}
+	feedCategories := make(map[uuid.UUID][]string)
+	for _, category := range categories {
+		feedCategories[category.FeedID] = append(feedCategories[category.FeedID], category.Name)
+	}
+
 	fmt.Printf("%s following:\n", user.Name)
 	for _, feed := range feeds {
+		if names := feedCategories[feed.FeedID]; len(names) > 0 {
+			fmt.Printf("- %s [%s]\n", feed.FeedName, strings.Join(names, ", "))
+			continue
+		}
 		fmt.Printf("- %s\n", feed.FeedName)
 	}
 
@@ -255,7 +548,7 @@ func handlerUnFollow(s *state, cmd command, user database.User) error {
 	}
 
 	ctx := context.Background()
-	feed, err := s.db.GetFeedByURL(ctx, cmd.args[0])
+	feed, err := feedForURL(ctx, s, cmd.args[0])
 	if err != nil {
 		return errors.New("failed to get feed")
 	}
@@ -291,11 +584,198 @@ func handlerBrowse(s *state, cmd command, user database.User) error {
 
 	for _, post := range posts {
 		fmt.Println("--------------------------------")
-		fmt.Printf("Title: %s\n", post.Title)
+		if post.Revisions > 0 {
+			fmt.Printf("Title: %s (updated)\n", post.Title)
+		} else {
+			fmt.Printf("Title: %s\n", post.Title)
+		}
 		fmt.Printf("URL: %s\n", post.Url)
+		if post.Author.Valid {
+			fmt.Printf("Author: %s\n", post.Author.String)
+		}
+		categories, err := s.db.GetPostCategories(context.Background(), post.ID)
+		if err != nil {
+			return err
+		}
+		if len(categories) > 0 {
+			fmt.Printf("Categories: %s\n", strings.Join(categories, ", "))
+		}
+		if post.CommentsUrl.Valid {
+			fmt.Printf("Comments: %s\n", post.CommentsUrl.String)
+		}
 		fmt.Printf("Description: %v\n", post.Description)
-		fmt.Printf("Published Date: %s\n", post.PublishedAt)
+		if post.Content.Valid {
+			fmt.Printf("Content: %s\n", post.Content.String)
+		}
+		if post.Undated {
+			fmt.Printf("Published Date: %s (undated, first seen)\n", post.PublishedAt)
+		} else {
+			fmt.Printf("Published Date: %s\n", post.PublishedAt)
+		}
+		if post.Revisions > 0 {
+			fmt.Printf("Updated: %s (%d revisions)\n", post.UpdatedAt, post.Revisions)
+		}
+	}
+
+	return nil
+}
+
+// handlerEnclosures dispatches the enclosure subcommands of the current user.
+func handlerEnclosures(s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return errors.New("missing subcommand")
+	}
+
+	sub := command{name: cmd.args[0], args: cmd.args[1:]}
+	switch sub.name {
+	case "download":
+		return handlerEnclosuresDownload(s, sub, user)
+	default:
+		return fmt.Errorf("unknown enclosures subcommand: %s", sub.name)
+	}
+}
+
+// handlerEnclosuresDownload downloads the media files of the followed feeds that have not been downloaded yet.
+// Interrupted downloads are resumed on the next run.
+func handlerEnclosuresDownload(s *state, cmd command, user database.User) error {
+	fs := newFlagSet(cmd.name)
+	feedURL := fs.String("feed", "", "only download the enclosures of this feed")
+	dir := fs.String("dir", "podcasts", "directory to save the files in")
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("too many arguments")
+	}
+
+	// Stop on Ctrl-C, keeping the partial file to resume from
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *feedURL != "" {
+		feed, err := feedForURL(ctx, s, *feedURL)
+		if err != nil {
+			return errors.New("this feed does not exist")
+		}
+		// the feed may have moved from the given url, or the url may be its website
+		*feedURL = feed.Url
+	}
+	enclosures, err := s.db.GetEnclosuresToDownload(ctx, database.GetEnclosuresToDownloadParams{
+		UserID:  user.ID,
+		FeedUrl: *feedURL,
+	})
+	if err != nil {
+		return err
+	}
+	if len(enclosures) == 0 {
+		fmt.Println("no enclosures to download")
+		return nil
 	}
 
+	failed := 0
+	for _, enclosure := range enclosures {
+		if ctx.Err() != nil {
+			return errors.New("download interrupted")
+		}
+		fmt.Printf("downloading %s: %s\n", enclosure.FeedName, enclosure.PostTitle)
+		dest, err := enclosurePath(*dir, enclosure.FeedName, enclosure.ID, enclosure.Url)
+		if err != nil {
+			return err
+		}
+		size, err := downloadEnclosure(ctx, s.fetcher, enclosure.Url, dest)
+		if err != nil {
+			fmt.Printf("Error: failed to download %s: %v\n", enclosure.Url, err)
+			failed++
+			continue
+		}
+		if err := s.db.SetEnclosureDownloaded(context.WithoutCancel(ctx), database.SetEnclosureDownloadedParams{
+			LocalPath:    dest,
+			DownloadedAt: time.Now(),
+			ID:           enclosure.ID,
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("- saved %s (%d bytes)\n", dest, size)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d enclosures failed", failed, len(enclosures))
+	}
+	return nil
+}
+
+// handlerImport dispatches the import subcommands.
+func handlerImport(s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return errors.New("missing subcommand")
+	}
+
+	sub := command{name: cmd.args[0], args: cmd.args[1:]}
+	switch sub.name {
+	case "opml":
+		return handlerImportOPML(s, sub, user)
+	default:
+		return fmt.Errorf("unknown import subcommand: %s", sub.name)
+	}
+}
+
+// handlerImportOPML adds and follows the feeds listed in an OPML file, such as the export of another feed reader.
+// Feeds that already exist are followed as they are, and the folders of the file become the categories of the follows.
+func handlerImportOPML(s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return errors.New("missing opml file")
+	}
+	if len(cmd.args) > 1 {
+		return errors.New("too many arguments")
+	}
+
+	file, err := os.Open(cmd.args[0])
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+	subscriptions, err := rss.ParseOPML(file)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		fmt.Println("no feeds to import")
+		return nil
+	}
+
+	ctx := context.Background()
+
+	follows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+	if err != nil {
+		return errors.New("unable to retrieve following feeds")
+	}
+	followed := make(map[uuid.UUID]bool, len(follows))
+	for _, follow := range follows {
+		followed[follow.FeedID] = true
+	}
+
+	var summary importSummary
+	for _, sub := range subscriptions {
+		created, err := importSubscription(ctx, s, user, sub, followed)
+		switch {
+		case err != nil:
+			fmt.Printf("Error: failed to import %s: %v\n", sub.URL, err)
+			summary.failed++
+		case created:
+			fmt.Printf("- added %s\n", sub.URL)
+			summary.created++
+		default:
+			fmt.Printf("- followed %s\n", sub.URL)
+			summary.existing++
+		}
+	}
+
+	fmt.Printf("imported %d feeds: %s\n", len(subscriptions), summary)
+	if summary.failed > 0 {
+		return fmt.Errorf("%d of %d feeds failed", summary.failed, len(subscriptions))
+	}
 	return nil
 }
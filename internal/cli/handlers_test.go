@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseIntervalOverride(t *testing.T) {
+	t.Run("accepts 0 and whole intervals", func(t *testing.T) {
+		tests := map[string]time.Duration{"0": 0, "1s": time.Second, "6h": 6 * time.Hour, "1.5s": 1500 * time.Millisecond}
+		for value, want := range tests {
+			got, err := parseIntervalOverride(value)
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", value, err)
+			} else if got != want {
+				t.Errorf("%s: expected %v, got %v", value, want, got)
+			}
+		}
+	})
+
+	t.Run("rejects intervals that cannot be stored", func(t *testing.T) {
+		for _, value := range []string{"-1h", "500ms", "1000000h", "soon"} {
+			if _, err := parseIntervalOverride(value); err == nil {
+				t.Errorf("%s: expected error", value)
+			}
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Nightails/gator/internal/database"
+	"github.com/Nightails/gator/internal/rss"
+	"github.com/google/uuid"
+)
+
+// importSummary counts the outcome of the subscriptions of an import.
+type importSummary struct {
+	created  int
+	existing int
+	failed   int
+}
+
+func (i importSummary) String() string {
+	return fmt.Sprintf("%d created, %d existing, %d failed", i.created, i.existing, i.failed)
+}
+
+// importSubscription adds the feed of sub unless a feed with its url exists, follows it for the user
+// and files the follow under the subscription's categories. followed holds the ids of the feeds the user follows
+// and is updated. It reports whether the feed was created.
+func importSubscription(ctx context.Context, s *state, user database.User, sub rss.Subscription, followed map[uuid.UUID]bool) (bool, error) {
+	if err := checkFeedURL(sub.URL); err != nil {
+		return false, err
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	qtx := s.db.WithTx(tx)
+
+	created := false
+	feed, err := qtx.GetFeedByURL(ctx, sub.URL)
+	if errors.Is(err, sql.ErrNoRows) {
+		feed, err = qtx.CreateFeed(ctx, database.CreateFeedParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Name:      cmp.Or(sub.Title, sub.URL),
+			Url:       sub.URL,
+			UserID:    user.ID,
+		})
+		created = true
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !followed[feed.ID] {
+		_, err := qtx.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+			FeedID:    feed.ID,
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to follow this feed: %w", err)
+		}
+	}
+	if len(sub.Categories) > 0 {
+		err := qtx.AddFeedFollowCategories(ctx, database.AddFeedFollowCategoriesParams{
+			UserID: user.ID,
+			FeedID: feed.ID,
+			Names:  sub.Categories,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	followed[feed.ID] = true
+	return created, nil
+}
+
+// checkFeedURL returns an error unless feedURL is an absolute http or https url.
+func checkFeedURL(feedURL string) error {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return fmt.Errorf("invalid feed url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid feed url: %s", feedURL)
+	}
+	return nil
+}
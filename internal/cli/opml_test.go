@@ -0,0 +1,21 @@
+package cli
+
+import "testing"
+
+func TestCheckFeedURL(t *testing.T) {
+	t.Run("accepts http and https urls", func(t *testing.T) {
+		for _, feedURL := range []string{"https://example.com/feed.xml", "http://example.com/rss"} {
+			if err := checkFeedURL(feedURL); err != nil {
+				t.Errorf("expected no error for %q, got %v", feedURL, err)
+			}
+		}
+	})
+
+	t.Run("rejects other urls", func(t *testing.T) {
+		for _, feedURL := range []string{"", "example.com/feed.xml", "feed://example.com/rss", "file:///tmp/feed.xml", "https://"} {
+			if err := checkFeedURL(feedURL); err == nil {
+				t.Errorf("expected error for %q", feedURL)
+			}
+		}
+	})
+}
@@ -5,97 +5,548 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Nightails/gator/internal/database"
 	"github.com/Nightails/gator/internal/rss"
 	"github.com/google/uuid"
-	"github.com/lib/pq"
 )
 
-// scrapeFeeds scrapes the next feed to fetch from the database and saves the posts to the database.
-func scrapeFeeds(s *state) error {
-	feedToFetch, err := s.db.GetNextFeedToFetch(context.Background())
+// feedLease is how long a claimed feed is reserved for the aggregator that claimed it.
+// Other aggregators skip the feed until the lease expires or the fetch completes.
+const feedLease = 5 * time.Minute
+
+// withFeedLease returns a context that expires with a lease taken now. Created before claiming feeds, it ends no later
+// than their leases, so that a fetch waiting for its turn at a busy host never runs after another aggregator
+// could have claimed the feed again.
+func withFeedLease(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, feedLease)
+}
+
+// savedPosts counts the items of a feed that were stored, those that updated an edited post,
+// and those skipped as already known.
+type savedPosts struct {
+	New        int
+	Updated    int
+	Duplicates int
+}
+
+// feedResult is the outcome of scraping a single feed.
+type feedResult struct {
+	Feed  database.Feed
+	Posts savedPosts
+	Err   error
+	// NotModified is set when the server reported that the feed did not change since the last fetch.
+	NotModified bool
+	// Aborted is set when the scrape was cancelled before it completed; the feed's lease is released instead of
+	// recording a result.
+	Aborted  bool
+	Duration time.Duration
+}
+
+// scrapeFeeds claims up to batch feeds that are due and scrapes them on a pool of workers goroutines.
+// Feeds last fetched at or after fetchedBefore are not claimed. A failing feed does not stop the others;
+// the outcome of every claimed feed is returned. When ctx is cancelled, or the lease runs out, in-flight fetches
+// are aborted and the remaining feeds are released.
+func scrapeFeeds(ctx context.Context, s *state, batch, workers int, fetchedBefore time.Time) ([]feedResult, error) {
+	ctx, cancel := withFeedLease(ctx)
+	defer cancel()
+	feeds, err := s.db.ClaimNextFeedsToFetch(ctx, database.ClaimNextFeedsToFetchParams{
+		LeaseSeconds:  int32(feedLease / time.Second),
+		FetchedBefore: fetchedBefore.UTC(),
+		BatchSize:     int32(batch),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get next feed to fetch: %w", err)
+		return nil, fmt.Errorf("failed to claim feeds to fetch: %w", err)
 	}
 
-	ctx := context.Background()
-	_ = s.db.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
-		ID: feedToFetch.ID,
+	jobs := make(chan int)
+	results := make([]feedResult, len(feeds))
+	var wg sync.WaitGroup
+	for range min(workers, len(feeds)) {
+		wg.Go(func() {
+			for i := range jobs {
+				results[i] = processFeed(ctx, s, feeds[i])
+			}
+		})
+	}
+	for i := range feeds {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
+// scrapeDueFeedsOnce scrapes every feed that is due exactly once, claiming batches until none are left.
+func scrapeDueFeedsOnce(ctx context.Context, s *state, batch, workers int) ([]feedResult, error) {
+	start := time.Now()
+	var all []feedResult
+	for ctx.Err() == nil {
+		results, err := scrapeFeeds(ctx, s, batch, workers, start)
+		if err != nil {
+			return all, err
+		}
+		if len(results) == 0 {
+			break
+		}
+		all = append(all, results...)
+	}
+	return all, nil
+}
+
+// processFeed scrapes a claimed feed and records the outcome. If ctx is cancelled before the scrape completes,
+// the lease is released so the feed is picked up again by the next run.
+func processFeed(ctx context.Context, s *state, feed database.Feed) feedResult {
+	start := time.Now()
+	var (
+		posts       savedPosts
+		notModified bool
+		scraped     bool
+		err         error
+	)
+	if ctx.Err() == nil {
+		posts, notModified, err = scrapeFeed(ctx, s, feed)
+		// the outcome of a completed scrape, modified or not, is already recorded
+		scraped = err == nil
+	}
+	duration := time.Since(start)
+
+	// Bookkeeping must complete even when the aggregator is shutting down
+	dbCtx := context.WithoutCancel(ctx)
+	if ctx.Err() != nil && !scraped {
+		if err := s.db.ReleaseFeedLease(dbCtx, feed.ID); err != nil {
+			fmt.Printf("Error: failed to release feed %s: %v\n", feed.Url, err)
+		}
+		return feedResult{Feed: feed, Aborted: true, Duration: duration}
+	}
+
+	if err != nil {
+		// A failed fetch still counts as fetched, it goes to the back of the queue and releases its lease
+		recordFeedError(dbCtx, s, feed, err)
+	}
+	return feedResult{
+		Feed:        feed,
+		Posts:       posts,
+		Err:         err,
+		NotModified: notModified,
+		Duration:    duration,
+	}
+}
+
+// Backoff applied to failing feeds: the delay before the next fetch doubles with every consecutive failure.
+const (
+	backoffBase = 5 * time.Minute
+	backoffMax  = 24 * time.Hour
+)
+
+// failureBackoff returns how long to wait before fetching a feed again after the given number of consecutive failures.
+func failureBackoff(failures int32) time.Duration {
+	delay := backoffBase
+	for i := int32(1); i < failures && delay < backoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, backoffMax)
+}
+
+// recordFeedError stores the error of a failed fetch on the feed and schedules its next fetch.
+// Successful fetches are recorded by scrapeFeed, with the feed's posts.
+func recordFeedError(ctx context.Context, s *state, feed database.Feed, fetchErr error) {
+	var err error
+	if retryAfter := rss.RetryAfter(fetchErr); retryAfter > 0 {
+		err = deferFeedFetch(ctx, s, feed, fetchErr, retryAfter)
+	} else {
+		err = recordFeedFailure(ctx, s, feed, fetchErr)
+	}
+	if err != nil {
+		fmt.Printf("Error: failed to record result for feed %s: %v\n", feed.Url, err)
+	}
+}
+
+// recordFeedFailure increments the feed's consecutive failure count, records the error, and pushes the next fetch out.
+// Once the count reaches the configured limit the feed is disabled. A feed answering 410 Gone is disabled right away.
+func recordFeedFailure(ctx context.Context, s *state, feed database.Feed, fetchErr error) error {
+	now := time.Now().UTC()
+	failures := feed.ConsecutiveFailures + 1
+	params := database.RecordFeedFailureParams{
+		ID: feed.ID,
+		LastError: sql.NullString{
+			String: fetchErr.Error(),
+			Valid:  true,
+		},
+		LastErrorAt: sql.NullTime{
+			Time:  now,
+			Valid: true,
+		},
+		NextFetchAt: sql.NullTime{
+			Time:  now.Add(failureBackoff(failures)),
+			Valid: true,
+		},
 		LastFetchedAt: sql.NullTime{
-			Time:  time.Now(),
+			Time:  now,
+			Valid: true,
+		},
+	}
+	var statusErr *rss.StatusError
+	disabledReason := ""
+	if errors.As(fetchErr, &statusErr) && statusErr.StatusCode == http.StatusGone {
+		disabledReason = "gone, the server answered 410 Gone"
+	} else if int(failures) >= s.cfg.FeedFailureLimit() {
+		disabledReason = fmt.Sprintf("%d consecutive failures", failures)
+	}
+	if disabledReason != "" && !feed.DisabledAt.Valid {
+		params.DisabledAt = sql.NullTime{
+			Time:  now,
+			Valid: true,
+		}
+		params.DisabledReason = sql.NullString{
+			String: disabledReason,
+			Valid:  true,
+		}
+		fmt.Printf("disabling feed %s: %s\n", feed.Url, disabledReason)
+	}
+	return s.db.RecordFeedFailure(ctx, params)
+}
+
+// deferFeedFetch records the error of a feed whose server asked to be retried later and schedules the next fetch
+// after the requested delay, capped to the maximum backoff. Rate limiting is not counted as a failure.
+func deferFeedFetch(ctx context.Context, s *state, feed database.Feed, fetchErr error, retryAfter time.Duration) error {
+	now := time.Now().UTC()
+	return s.db.DeferFeedFetch(ctx, database.DeferFeedFetchParams{
+		ID: feed.ID,
+		LastError: sql.NullString{
+			String: fetchErr.Error(),
+			Valid:  true,
+		},
+		LastErrorAt: sql.NullTime{
+			Time:  now,
+			Valid: true,
+		},
+		NextFetchAt: sql.NullTime{
+			Time:  now.Add(min(retryAfter, backoffMax)),
+			Valid: true,
+		},
+		LastFetchedAt: sql.NullTime{
+			Time:  now,
 			Valid: true,
 		},
 	})
+}
+
+// recordFeedSuccess marks the feed fetched, resets its failure count and schedules its next fetch from the refresh
+// hints published by the feed, or the user's interval override when one is set. This releases the feed's lease.
+// rssFeed is nil when the feed was not modified, the stored minimum interval is reused in that case.
+func recordFeedSuccess(ctx context.Context, q *database.Queries, feed database.Feed, rssFeed *rss.Feed) error {
+	schedule := storedSchedule(feed)
+	if rssFeed != nil {
+		schedule = rssFeed.Schedule()
+	}
+	interval := schedule.Interval
+	if feed.IntervalOverrideSeconds.Valid {
+		interval = time.Duration(feed.IntervalOverrideSeconds.Int32) * time.Second
+	}
+
+	now := time.Now().UTC()
+	params := database.RecordFeedSuccessParams{
+		ID: feed.ID,
+		MinIntervalSeconds: sql.NullInt32{
+			Int32: int32(schedule.Interval / time.Second),
+			Valid: schedule.Interval > 0,
+		},
+		LastFetchedAt: sql.NullTime{
+			Time:  now,
+			Valid: true,
+		},
+		SkipHours: make([]int32, 0, len(schedule.SkipHours)),
+		SkipDays:  make([]int32, 0, len(schedule.SkipDays)),
+	}
+	for _, hour := range schedule.SkipHours {
+		params.SkipHours = append(params.SkipHours, int32(hour))
+	}
+	for _, day := range schedule.SkipDays {
+		params.SkipDays = append(params.SkipDays, int32(day))
+	}
+	if next := schedule.Next(now, interval); next.After(now) {
+		params.NextFetchAt = sql.NullTime{
+			Time:  next,
+			Valid: true,
+		}
+	}
+	return q.RecordFeedSuccess(ctx, params)
+}
+
+// storedSchedule returns the refresh hints stored on the feed by its last successful fetch, used when the feed
+// was not modified since.
+func storedSchedule(feed database.Feed) rss.Schedule {
+	schedule := rss.Schedule{Interval: time.Duration(feed.MinIntervalSeconds.Int32) * time.Second}
+	for _, hour := range feed.SkipHours {
+		schedule.SkipHours = append(schedule.SkipHours, int(hour))
+	}
+	for _, day := range feed.SkipDays {
+		schedule.SkipDays = append(schedule.SkipDays, time.Weekday(day))
+	}
+	return schedule
+}
 
-	rssFeed, err := rss.FetchFeed(ctx, feedToFetch.Url)
+// scrapeFeed fetches a single feed and saves its posts to the database. It returns the number of saved posts
+// and whether the feed was not modified since the last fetch.
+// The posts are saved and the success is recorded in a single transaction.
+func scrapeFeed(ctx context.Context, s *state, feedToFetch database.Feed) (savedPosts, bool, error) {
+	rssFeed, err := s.fetcher.FetchFeed(ctx, feedToFetch.Url, rss.CacheHeaders{
+		ETag:         feedToFetch.Etag.String,
+		LastModified: feedToFetch.LastModified.String,
+	})
+	var notModified *rss.NotModifiedError
+	if errors.As(err, &notModified) {
+		// Nothing changed since the last fetch, but the feed may have moved
+		if err := moveFeed(ctx, s.db, feedToFetch, notModified.MovedTo); err != nil {
+			return savedPosts{}, false, fmt.Errorf("failed to move feed: %w", err)
+		}
+		if err := recordFeedSuccess(ctx, s.db, feedToFetch, nil); err != nil {
+			return savedPosts{}, false, fmt.Errorf("failed to record feed success: %w", err)
+		}
+		return savedPosts{}, true, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to fetch feed: %w", err)
+		return savedPosts{}, false, fmt.Errorf("failed to fetch feed: %w", err)
 	}
 	rssFeed.UnescapeString()
-	if err := savePostsToDB(rssFeed, feedToFetch.ID, s); err != nil {
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return savedPosts{}, false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	qtx := s.db.WithTx(tx)
+
+	posts, err := savePostsToDB(ctx, qtx, rssFeed, feedToFetch.ID)
+	if err != nil {
+		return savedPosts{}, false, fmt.Errorf("failed to save posts: %w", err)
+	}
+
+	if err := qtx.SetFeedCacheHeaders(ctx, database.SetFeedCacheHeadersParams{
+		ID: feedToFetch.ID,
+		Etag: sql.NullString{
+			String: rssFeed.Cache.ETag,
+			Valid:  rssFeed.Cache.ETag != "",
+		},
+		LastModified: sql.NullString{
+			String: rssFeed.Cache.LastModified,
+			Valid:  rssFeed.Cache.LastModified != "",
+		},
+	}); err != nil {
+		return savedPosts{}, false, fmt.Errorf("failed to save feed cache headers: %w", err)
+	}
+	if err := moveFeed(ctx, qtx, feedToFetch, rssFeed.MovedTo); err != nil {
+		return savedPosts{}, false, fmt.Errorf("failed to move feed: %w", err)
+	}
+	if err := recordFeedSuccess(ctx, qtx, feedToFetch, rssFeed); err != nil {
+		return savedPosts{}, false, fmt.Errorf("failed to record feed success: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return savedPosts{}, false, err
+	}
+	return posts, false, nil
+}
+
+// moveFeed points the feed at the url it permanently redirected to, and keeps the old url in the feed's history
+// so that commands given the old url still find it. A move onto the url of another feed is skipped.
+func moveFeed(ctx context.Context, q *database.Queries, feed database.Feed, newURL string) error {
+	if newURL == "" || newURL == feed.Url {
+		return nil
+	}
+	other, err := q.GetFeedByURL(ctx, newURL)
+	if err == nil && other.ID != feed.ID {
+		fmt.Printf("feed %s moved to %s, which is already the feed %s, keeping the old url\n", feed.Url, newURL, other.Name)
+		return nil
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
 
+	now := time.Now()
+	if err := q.AddFeedURLHistory(ctx, database.AddFeedURLHistoryParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		FeedID:    feed.ID,
+		Url:       feed.Url,
+	}); err != nil {
+		return err
+	}
+	if err := q.UpdateFeedURL(ctx, database.UpdateFeedURLParams{
+		ID:        feed.ID,
+		Url:       newURL,
+		UpdatedAt: now,
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("feed %s moved permanently to %s\n", feed.Url, newURL)
 	return nil
 }
 
-// savePostsToDB saves the posts of the given RSS feed to the database.
-func savePostsToDB(feed *rss.Feed, feedID uuid.UUID, s *state) error {
+// postgresTimestamp is the layout used to pass timestamps to PostgreSQL inside text arrays.
+const postgresTimestamp = "2006-01-02 15:04:05.999999Z07:00"
+
+// savePostsToDB saves the posts of the given RSS feed to the database in a single statement and counts the new,
+// updated and duplicate posts. Items the feed edited since they were stored update the existing post.
+func savePostsToDB(ctx context.Context, q *database.Queries, feed *rss.Feed, feedID uuid.UUID) (savedPosts, error) {
+	params := database.UpsertPostsParams{
+		CreatedAt: time.Now(),
+		FeedID:    feedID,
+	}
+	seen := make(map[string]bool)
+	items := make(map[string]rss.Item)
 	for _, item := range feed.Channel.Item {
-		publishedAt, err := parseTime(item.PubDate)
-		if err != nil {
-			fmt.Printf("Error: failed to parse publish date '%s': %v\n", item.PubDate, err)
+		// A post can only be written once per statement, keep the first item with a given key
+		key := item.Key()
+		if seen[key] {
 			continue
 		}
+		seen[key] = true
 
-		if _, err := s.db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:        uuid.New(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			Title:     item.Title,
-			Url:       item.Link,
-			Description: sql.NullString{
-				String: item.Description,
-				Valid:  true,
-			},
-			PublishedAt: publishedAt,
-			FeedID:      feedID,
-		}); err != nil {
-			// Check if the error is a unique constraint violation on URL
-			var pqErr *pq.Error
-			if errors.As(err, &pqErr) && pqErr.Code == "23505" {
-				// Silently skip duplicate URLs
-				continue
-			}
-			// Log all other errors
-			fmt.Printf("Error: failed to save post: %v\n", err)
+		// Items without a usable date are stored with the fetch time and flagged as undated
+		publishedAt, err := parseTime(item.PubDate)
+		undated := err != nil
+		if undated {
+			publishedAt = params.CreatedAt
 		}
+
+		params.Ids = append(params.Ids, uuid.New())
+		params.Titles = append(params.Titles, item.Title)
+		params.Urls = append(params.Urls, item.Link)
+		params.Descriptions = append(params.Descriptions, item.Description)
+		params.PublishedAts = append(params.PublishedAts, publishedAt.UTC().Format(postgresTimestamp))
+		params.Undated = append(params.Undated, undated)
+		params.Guids = append(params.Guids, key)
+		params.ContentHashes = append(params.ContentHashes, item.ContentHash())
+		params.Authors = append(params.Authors, item.Author)
+		params.CommentsUrls = append(params.CommentsUrls, item.Comments)
+		params.Contents = append(params.Contents, item.Content)
+		items[key] = item
 	}
 
-	return nil
+	var saved savedPosts
+	if len(params.Ids) == 0 {
+		return saved, nil
+	}
+
+	if rekey := legacyRekeys(params); len(rekey.Urls) > 0 {
+		if err := q.RekeyLegacyPosts(ctx, rekey); err != nil {
+			return saved, err
+		}
+	}
+
+	// Unchanged posts are not returned
+	written, err := q.UpsertPosts(ctx, params)
+	if err != nil {
+		return saved, err
+	}
+	created := make(map[uuid.UUID]bool, len(params.Ids))
+	for _, id := range params.Ids {
+		created[id] = true
+	}
+	for _, post := range written {
+		// An updated post keeps the id it was created with
+		if created[post.ID] {
+			saved.New++
+		} else {
+			saved.Updated++
+		}
+	}
+	saved.Duplicates = len(params.Ids) - len(written)
+
+	if err := savePostCategories(ctx, q, written, items); err != nil {
+		return saved, err
+	}
+	if err := saveEnclosures(ctx, q, feedID, params.Guids, items); err != nil {
+		return saved, err
+	}
+
+	return saved, nil
 }
 
-// parseTime parses the given date string into a time.Time.
-func parseTime(dateStr string) (time.Time, error) {
-	formats := []string{
-		time.RFC1123Z,
-		time.RFC1123,
-		time.RFC822Z,
-		time.RFC822,
-		"2006-01-02T15:04:05Z07:00", // ISO 8601
-		"2006-01-02 15:04:05",
+// legacyRekeys returns the parameters giving the posts stored before guids existed, which are keyed on their url,
+// the guid of the post about to be written with that url. Items keyed on their link need no rekeying.
+func legacyRekeys(params database.UpsertPostsParams) database.RekeyLegacyPostsParams {
+	rekey := database.RekeyLegacyPostsParams{FeedID: params.FeedID}
+	for i, key := range params.Guids {
+		if url := params.Urls[i]; url != "" && url != key {
+			rekey.Urls = append(rekey.Urls, url)
+			rekey.Guids = append(rekey.Guids, key)
+		}
 	}
+	return rekey
+}
 
-	for _, format := range formats {
-		t, err := time.Parse(format, dateStr)
-		if err == nil {
-			return t, nil
+// savePostCategories replaces the categories of the written posts with the ones from their feed items, keyed by guid.
+func savePostCategories(ctx context.Context, q *database.Queries, posts []database.Post, items map[string]rss.Item) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	var ids []uuid.UUID
+	var params database.AddPostCategoriesParams
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+		for _, name := range items[post.Guid].Categories {
+			params.PostIds = append(params.PostIds, post.ID)
+			params.Names = append(params.Names, name)
 		}
 	}
+	if err := q.DeletePostCategories(ctx, ids); err != nil {
+		return err
+	}
+	if len(params.PostIds) == 0 {
+		return nil
+	}
+	return q.AddPostCategories(ctx, params)
+}
+
+// saveEnclosures stores the media files attached to the feed items with the given guids, including those of
+// unchanged posts, so that the episodes stored before enclosures were recorded get theirs.
+// Enclosures that disappear from an item are kept, so that downloaded files stay recorded.
+func saveEnclosures(ctx context.Context, q *database.Queries, feedID uuid.UUID, guids []string, items map[string]rss.Item) error {
+	if !slices.ContainsFunc(guids, func(guid string) bool { return len(items[guid].Enclosures) > 0 }) {
+		return nil
+	}
+	posts, err := q.GetPostIDsByGuids(ctx, database.GetPostIDsByGuidsParams{
+		FeedID: feedID,
+		Guids:  guids,
+	})
+	if err != nil {
+		return err
+	}
 
-	return time.Time{}, fmt.Errorf("failed to parse date: %s", dateStr)
+	params := database.UpsertEnclosuresParams{CreatedAt: time.Now()}
+	for _, post := range posts {
+		item := items[post.Guid]
+		seen := make(map[string]bool)
+		for _, enclosure := range item.Enclosures {
+			url := strings.TrimSpace(enclosure.URL)
+			if url == "" || seen[url] {
+				continue
+			}
+			seen[url] = true
+
+			params.Ids = append(params.Ids, uuid.New())
+			params.PostIds = append(params.PostIds, post.ID)
+			params.Urls = append(params.Urls, url)
+			params.Lengths = append(params.Lengths, enclosure.Size())
+			params.MimeTypes = append(params.MimeTypes, enclosure.Type)
+			params.Durations = append(params.Durations, item.DurationSeconds())
+			params.ImageUrls = append(params.ImageUrls, item.Image.Href)
+		}
+	}
+	if len(params.Ids) == 0 {
+		return nil
+	}
+	return q.UpsertEnclosures(ctx, params)
 }
 
 // printRSSFeed prints the given RSS feed to the console.
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Nightails/gator/internal/database"
+	"github.com/Nightails/gator/internal/rss"
+	"github.com/google/uuid"
+)
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{failures: 1, want: backoffBase},
+		{failures: 2, want: 2 * backoffBase},
+		{failures: 4, want: 8 * backoffBase},
+		{failures: 50, want: backoffMax},
+	}
+
+	for _, tt := range tests {
+		if got := failureBackoff(tt.failures); got != tt.want {
+			t.Errorf("failureBackoff(%d): expected %v, got %v", tt.failures, tt.want, got)
+		}
+	}
+}
+
+func TestLegacyRekeys(t *testing.T) {
+	withGUID := rss.Item{GUID: "tag:example.com,2024:post-1", Link: "https://example.com/?p=1"}
+	withLink := rss.Item{Title: "Hello", Link: "https://example.com/hello"}
+	withoutLink := rss.Item{GUID: "episode-1"}
+	params := database.UpsertPostsParams{FeedID: uuid.New()}
+	for _, item := range []rss.Item{withGUID, withLink, withoutLink} {
+		params.Guids = append(params.Guids, item.Key())
+		params.Urls = append(params.Urls, item.Link)
+	}
+
+	rekey := legacyRekeys(params)
+	if rekey.FeedID != params.FeedID {
+		t.Errorf("expected feed %s, got %s", params.FeedID, rekey.FeedID)
+	}
+	if !slices.Equal(rekey.Urls, []string{withGUID.Link}) || !slices.Equal(rekey.Guids, []string{withGUID.GUID}) {
+		t.Errorf("expected only the item with a guid to be rekeyed, got urls %v and guids %v", rekey.Urls, rekey.Guids)
+	}
+}
+
+func TestStoredSchedule(t *testing.T) {
+	feed := database.Feed{
+		MinIntervalSeconds: sql.NullInt32{Int32: 3600, Valid: true},
+		SkipHours:          []int32{0, 23},
+		SkipDays:           []int32{int32(time.Saturday), int32(time.Sunday)},
+	}
+	schedule := storedSchedule(feed)
+	if schedule.Interval != time.Hour {
+		t.Errorf("expected 1h interval, got %v", schedule.Interval)
+	}
+	if !slices.Equal(schedule.SkipHours, []int{0, 23}) {
+		t.Errorf("expected skip hours 0 and 23, got %v", schedule.SkipHours)
+	}
+	if !slices.Equal(schedule.SkipDays, []time.Weekday{time.Saturday, time.Sunday}) {
+		t.Errorf("expected weekend skip days, got %v", schedule.SkipDays)
+	}
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// aggSummary accumulates the outcome of every feed scraped during an agg run.
+type aggSummary struct {
+	fetched int
+	failed  int
+	aborted int
+}
+
+// count adds the given results to the totals.
+func (a *aggSummary) count(results []feedResult) {
+	for _, result := range results {
+		switch {
+		case result.Aborted:
+			a.aborted++
+		case result.Err != nil:
+			a.failed++
+		default:
+			a.fetched++
+		}
+	}
+}
+
+// add counts the given results and logs the failures.
+func (a *aggSummary) add(results []feedResult) {
+	a.count(results)
+	for _, result := range results {
+		if !result.Aborted && result.Err != nil {
+			fmt.Printf("Error: %s: %v\n", result.Feed.Url, result.Err)
+		}
+	}
+}
+
+// print writes the totals to the console.
+func (a *aggSummary) print() {
+	fmt.Printf("fetched %d feeds, %d failed, %d aborted\n", a.fetched, a.failed, a.aborted)
+}
+
+// printResults writes a table with the outcome of each scraped feed to the console, followed by the totals.
+func printResults(results []feedResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "FEED\tNEW\tUPDATED\tDUPLICATES\tDURATION\tSTATUS")
+	for _, result := range results {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n",
+			result.Feed.Url,
+			result.Posts.New,
+			result.Posts.Updated,
+			result.Posts.Duplicates,
+			result.Duration.Round(time.Millisecond),
+			resultStatus(result),
+		)
+	}
+	_ = w.Flush()
+
+	var summary aggSummary
+	summary.count(results)
+	summary.print()
+}
+
+// resultStatus describes the outcome of a scraped feed in a word, or the error that made it fail.
+func resultStatus(result feedResult) string {
+	switch {
+	case result.Aborted:
+		return "aborted"
+	case result.Err != nil:
+		return "error: " + result.Err.Error()
+	case result.NotModified:
+		return "not modified"
+	default:
+		return "ok"
+	}
+}
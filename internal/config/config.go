@@ -7,12 +7,35 @@ import (
 )
 
 type Config struct {
-	URL      string `json:"db_url"`
-	UserName string `json:"current_user_name"`
+	URL             string `json:"db_url"`
+	UserName        string `json:"current_user_name"`
+	MaxFeedFailures int    `json:"max_feed_failures,omitempty"`
+	MaxFeedBytes    int64  `json:"max_feed_bytes,omitempty"`
+	// HTTP client used to fetch feeds. Unset fields select the fetcher's defaults, 0 disables redirects and retries
+	UserAgent           string `json:"user_agent,omitempty"`
+	ProxyURL            string `json:"proxy_url,omitempty"`
+	FetchTimeoutSeconds int    `json:"fetch_timeout_seconds,omitempty"`
+	MaxRedirects        *int   `json:"max_redirects,omitempty"`
+	FetchRetries        *int   `json:"fetch_retries,omitempty"`
+	// Requests per second and burst allowed per host
+	HostRateLimit float64 `json:"host_rate_limit,omitempty"`
+	HostBurst     int     `json:"host_burst,omitempty"`
 }
 
 const configFileName = ".gatorconfig.json"
 
+// defaultMaxFeedFailures is the number of consecutive failures after which a feed is disabled
+// when max_feed_failures is not set.
+const defaultMaxFeedFailures = 10
+
+// FeedFailureLimit returns the number of consecutive failures after which a feed is disabled.
+func (cfg Config) FeedFailureLimit() int {
+	if cfg.MaxFeedFailures <= 0 {
+		return defaultMaxFeedFailures
+	}
+	return cfg.MaxFeedFailures
+}
+
 func Read() Config {
 	cfgPath, err := getConfigFilePath()
 	if err != nil {
@@ -35,7 +58,7 @@ func Read() Config {
 func (cfg Config) SetUser(userName string) {
 	cfg.UserName = userName
 	if err := write(cfg); err != nil {
-		fmt.Errorf("failed to write config: %v", err)
+		fmt.Printf("error: failed to write config: %v\n", err)
 	}
 }
 
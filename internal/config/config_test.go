@@ -372,3 +372,19 @@ func TestSetUser(t *testing.T) {
 		}
 	})
 }
+
+func TestFeedFailureLimit(t *testing.T) {
+	t.Run("defaults when unset", func(t *testing.T) {
+		cfg := Config{}
+		if got := cfg.FeedFailureLimit(); got != defaultMaxFeedFailures {
+			t.Errorf("expected %d, got %d", defaultMaxFeedFailures, got)
+		}
+	})
+
+	t.Run("uses configured value", func(t *testing.T) {
+		cfg := Config{MaxFeedFailures: 3}
+		if got := cfg.FeedFailureLimit(); got != 3 {
+			t.Errorf("expected 3, got %d", got)
+		}
+	})
+}
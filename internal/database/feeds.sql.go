@@ -11,12 +11,128 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const claimFeedByID = `-- name: ClaimFeedByID :one
+UPDATE feeds
+SET lease_expires_at = (now() AT TIME ZONE 'UTC') + make_interval(secs => $1::int)
+WHERE id = (
+    SELECT id FROM feeds
+    WHERE feeds.id = $2
+      AND (lease_expires_at IS NULL OR lease_expires_at < now() AT TIME ZONE 'UTC')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_expires_at, consecutive_failures, last_error, last_error_at, next_fetch_at, disabled_at, min_interval_seconds, interval_override_seconds, disabled_reason, skip_hours, skip_days
+`
+
+type ClaimFeedByIDParams struct {
+	LeaseSeconds int32
+	ID           uuid.UUID
+}
+
+// Claims a single feed whether or not it is due. No row is returned while another aggregator holds its lease.
+func (q *Queries) ClaimFeedByID(ctx context.Context, arg ClaimFeedByIDParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, claimFeedByID, arg.LeaseSeconds, arg.ID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LeaseExpiresAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.NextFetchAt,
+		&i.DisabledAt,
+		&i.MinIntervalSeconds,
+		&i.IntervalOverrideSeconds,
+		&i.DisabledReason,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+	)
+	return i, err
+}
+
+const claimNextFeedsToFetch = `-- name: ClaimNextFeedsToFetch :many
+UPDATE feeds
+SET lease_expires_at = (now() AT TIME ZONE 'UTC') + make_interval(secs => $1::int)
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE disabled_at IS NULL
+      AND (next_fetch_at IS NULL OR next_fetch_at <= now() AT TIME ZONE 'UTC')
+      AND (lease_expires_at IS NULL OR lease_expires_at < now() AT TIME ZONE 'UTC')
+      AND (last_fetched_at IS NULL OR last_fetched_at < $2::timestamp)
+      AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+    ORDER BY last_fetched_at ASC NULLS FIRST
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_expires_at, consecutive_failures, last_error, last_error_at, next_fetch_at, disabled_at, min_interval_seconds, interval_override_seconds, disabled_reason, skip_hours, skip_days
+`
+
+type ClaimNextFeedsToFetchParams struct {
+	LeaseSeconds  int32
+	FetchedBefore time.Time
+	BatchSize     int32
+}
+
+// Leases and due times are checked against the database clock, in UTC like the other scheduling times,
+// so that aggregators on hosts with different clocks or time zones agree on them.
+func (q *Queries) ClaimNextFeedsToFetch(ctx context.Context, arg ClaimNextFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimNextFeedsToFetch, arg.LeaseSeconds, arg.FetchedBefore, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LeaseExpiresAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.NextFetchAt,
+			&i.DisabledAt,
+			&i.MinIntervalSeconds,
+			&i.IntervalOverrideSeconds,
+			&i.DisabledReason,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds(id, created_at, updated_at, name, url, user_id)
 VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_expires_at, consecutive_failures, last_error, last_error_at, next_fetch_at, disabled_at, min_interval_seconds, interval_override_seconds, disabled_reason, skip_hours, skip_days
 `
 
 type CreateFeedParams struct {
@@ -46,15 +162,174 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LeaseExpiresAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.NextFetchAt,
+		&i.DisabledAt,
+		&i.MinIntervalSeconds,
+		&i.IntervalOverrideSeconds,
+		&i.DisabledReason,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
 	)
 	return i, err
 }
 
+const deferFeedFetch = `-- name: DeferFeedFetch :exec
+UPDATE feeds
+SET last_error = $2, last_error_at = $3, next_fetch_at = $4, last_fetched_at = $5, updated_at = $5, lease_expires_at = NULL
+WHERE id = $1
+`
+
+type DeferFeedFetchParams struct {
+	ID            uuid.UUID
+	LastError     sql.NullString
+	LastErrorAt   sql.NullTime
+	NextFetchAt   sql.NullTime
+	LastFetchedAt sql.NullTime
+}
+
+// Pushes the next fetch out as asked by the server, without counting a failure. Releases the feed's lease.
+func (q *Queries) DeferFeedFetch(ctx context.Context, arg DeferFeedFetchParams) error {
+	_, err := q.db.ExecContext(ctx, deferFeedFetch,
+		arg.ID,
+		arg.LastError,
+		arg.LastErrorAt,
+		arg.NextFetchAt,
+		arg.LastFetchedAt,
+	)
+	return err
+}
+
+const deleteOrphanedFeeds = `-- name: DeleteOrphanedFeeds :many
+DELETE FROM feeds
+WHERE NOT EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_expires_at, consecutive_failures, last_error, last_error_at, next_fetch_at, disabled_at, min_interval_seconds, interval_override_seconds, disabled_reason, skip_hours, skip_days
+`
+
+func (q *Queries) DeleteOrphanedFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, deleteOrphanedFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LeaseExpiresAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.NextFetchAt,
+			&i.DisabledAt,
+			&i.MinIntervalSeconds,
+			&i.IntervalOverrideSeconds,
+			&i.DisabledReason,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const enableFeed = `-- name: EnableFeed :exec
+UPDATE feeds
+SET disabled_at = NULL, disabled_reason = NULL, consecutive_failures = 0, next_fetch_at = NULL, updated_at = $2
+WHERE id = $1
+`
+
+type EnableFeedParams struct {
+	ID        uuid.UUID
+	UpdatedAt time.Time
+}
+
+func (q *Queries) EnableFeed(ctx context.Context, arg EnableFeedParams) error {
+	_, err := q.db.ExecContext(ctx, enableFeed, arg.ID, arg.UpdatedAt)
+	return err
+}
+
+const getBrokenFeeds = `-- name: GetBrokenFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_expires_at, consecutive_failures, last_error, last_error_at, next_fetch_at, disabled_at, min_interval_seconds, interval_override_seconds, disabled_reason, skip_hours, skip_days FROM feeds
+WHERE disabled_at IS NOT NULL OR consecutive_failures > 0
+ORDER BY consecutive_failures DESC
+`
+
+func (q *Queries) GetBrokenFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getBrokenFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LeaseExpiresAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.NextFetchAt,
+			&i.DisabledAt,
+			&i.MinIntervalSeconds,
+			&i.IntervalOverrideSeconds,
+			&i.DisabledReason,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-WHERE url = $1
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_expires_at, consecutive_failures, last_error, last_error_at, next_fetch_at, disabled_at, min_interval_seconds, interval_override_seconds, disabled_reason, skip_hours, skip_days FROM feeds
+WHERE feeds.url = $1
+   OR feeds.id = (SELECT feed_url_history.feed_id FROM feed_url_history WHERE feed_url_history.url = $1)
+ORDER BY feeds.url = $1 DESC
+LIMIT 1
 `
 
+// Also finds feeds that moved away from the url.
 func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 	row := q.db.QueryRowContext(ctx, getFeedByURL, url)
 	var i Feed
@@ -66,12 +341,25 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LeaseExpiresAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.NextFetchAt,
+		&i.DisabledAt,
+		&i.MinIntervalSeconds,
+		&i.IntervalOverrideSeconds,
+		&i.DisabledReason,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_expires_at, consecutive_failures, last_error, last_error_at, next_fetch_at, disabled_at, min_interval_seconds, interval_override_seconds, disabled_reason, skip_hours, skip_days FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -91,6 +379,19 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LeaseExpiresAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.NextFetchAt,
+			&i.DisabledAt,
+			&i.MinIntervalSeconds,
+			&i.IntervalOverrideSeconds,
+			&i.DisabledReason,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
 		); err != nil {
 			return nil, err
 		}
@@ -105,39 +406,181 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const getOrphanedFeeds = `-- name: GetOrphanedFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_expires_at, consecutive_failures, last_error, last_error_at, next_fetch_at, disabled_at, min_interval_seconds, interval_override_seconds, disabled_reason, skip_hours, skip_days FROM feeds
+WHERE NOT EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
+func (q *Queries) GetOrphanedFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getOrphanedFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LeaseExpiresAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.NextFetchAt,
+			&i.DisabledAt,
+			&i.MinIntervalSeconds,
+			&i.IntervalOverrideSeconds,
+			&i.DisabledReason,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordFeedFailure = `-- name: RecordFeedFailure :exec
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1, last_error = $2, last_error_at = $3, next_fetch_at = $4,
+    disabled_at = COALESCE(disabled_at, $5), disabled_reason = COALESCE(disabled_reason, $6),
+    last_fetched_at = $7, updated_at = $7, lease_expires_at = NULL
+WHERE id = $1
+`
+
+type RecordFeedFailureParams struct {
+	ID             uuid.UUID
+	LastError      sql.NullString
+	LastErrorAt    sql.NullTime
+	NextFetchAt    sql.NullTime
+	DisabledAt     sql.NullTime
+	DisabledReason sql.NullString
+	LastFetchedAt  sql.NullTime
+}
+
+// A feed that is already disabled stays disabled with its reason, a NULL disabled_at leaves it enabled.
+// Also marks the feed fetched and releases its lease, so that it is never claimed before its next fetch is scheduled.
+func (q *Queries) RecordFeedFailure(ctx context.Context, arg RecordFeedFailureParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedFailure,
+		arg.ID,
+		arg.LastError,
+		arg.LastErrorAt,
+		arg.NextFetchAt,
+		arg.DisabledAt,
+		arg.DisabledReason,
+		arg.LastFetchedAt,
 	)
-	return i, err
+	return err
 }
 
-const markFeedFetched = `-- name: MarkFeedFetched :exec
+const recordFeedSuccess = `-- name: RecordFeedSuccess :exec
 UPDATE feeds
-SET last_fetched_at = $2, updated_at = $2
+SET consecutive_failures = 0, next_fetch_at = $2, min_interval_seconds = $3, skip_hours = $5, skip_days = $6,
+    last_fetched_at = $4, updated_at = $4, lease_expires_at = NULL
 WHERE id = $1
 `
 
-type MarkFeedFetchedParams struct {
-	ID            uuid.UUID
-	LastFetchedAt sql.NullTime
+type RecordFeedSuccessParams struct {
+	ID                 uuid.UUID
+	NextFetchAt        sql.NullTime
+	MinIntervalSeconds sql.NullInt32
+	LastFetchedAt      sql.NullTime
+	SkipHours          []int32
+	SkipDays           []int32
+}
+
+// Also marks the feed fetched and releases its lease, so that it is never claimed before its next fetch is scheduled.
+func (q *Queries) RecordFeedSuccess(ctx context.Context, arg RecordFeedSuccessParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedSuccess,
+		arg.ID,
+		arg.NextFetchAt,
+		arg.MinIntervalSeconds,
+		arg.LastFetchedAt,
+		pq.Array(arg.SkipHours),
+		pq.Array(arg.SkipDays),
+	)
+	return err
+}
+
+const releaseFeedLease = `-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_expires_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) ReleaseFeedLease(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedLease, id)
+	return err
+}
+
+const setFeedCacheHeaders = `-- name: SetFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3
+WHERE id = $1
+`
+
+type SetFeedCacheHeadersParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) SetFeedCacheHeaders(ctx context.Context, arg SetFeedCacheHeadersParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedCacheHeaders, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
+
+const setFeedIntervalOverride = `-- name: SetFeedIntervalOverride :exec
+UPDATE feeds
+SET interval_override_seconds = $2, next_fetch_at = $3, updated_at = $4
+WHERE id = $1
+`
+
+type SetFeedIntervalOverrideParams struct {
+	ID                      uuid.UUID
+	IntervalOverrideSeconds sql.NullInt32
+	NextFetchAt             sql.NullTime
+	UpdatedAt               time.Time
+}
+
+func (q *Queries) SetFeedIntervalOverride(ctx context.Context, arg SetFeedIntervalOverrideParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedIntervalOverride,
+		arg.ID,
+		arg.IntervalOverrideSeconds,
+		arg.NextFetchAt,
+		arg.UpdatedAt,
+	)
+	return err
+}
+
+const updateFeedURL = `-- name: UpdateFeedURL :exec
+UPDATE feeds
+SET url = $2, updated_at = $3
+WHERE id = $1
+`
+
+type UpdateFeedURLParams struct {
+	ID        uuid.UUID
+	Url       string
+	UpdatedAt time.Time
 }
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.ID, arg.LastFetchedAt)
+func (q *Queries) UpdateFeedURL(ctx context.Context, arg UpdateFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedURL, arg.ID, arg.Url, arg.UpdatedAt)
 	return err
 }
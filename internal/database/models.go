@@ -11,14 +11,41 @@ import (
 	"github.com/google/uuid"
 )
 
+type Enclosure struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	PostID          uuid.UUID
+	Url             string
+	Length          sql.NullInt64
+	MimeType        sql.NullString
+	DurationSeconds sql.NullInt32
+	ImageUrl        sql.NullString
+	LocalPath       sql.NullString
+	DownloadedAt    sql.NullTime
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                      uuid.UUID
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
+	Name                    string
+	Url                     string
+	UserID                  uuid.UUID
+	LastFetchedAt           sql.NullTime
+	Etag                    sql.NullString
+	LastModified            sql.NullString
+	LeaseExpiresAt          sql.NullTime
+	ConsecutiveFailures     int32
+	LastError               sql.NullString
+	LastErrorAt             sql.NullTime
+	NextFetchAt             sql.NullTime
+	DisabledAt              sql.NullTime
+	MinIntervalSeconds      sql.NullInt32
+	IntervalOverrideSeconds sql.NullInt32
+	DisabledReason          sql.NullString
+	SkipHours               []int32
+	SkipDays                []int32
 }
 
 type FeedFollow struct {
@@ -29,6 +56,19 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FeedFollowCategory struct {
+	UserID uuid.UUID
+	FeedID uuid.UUID
+	Name   string
+}
+
+type FeedUrlHistory struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	FeedID    uuid.UUID
+	Url       string
+}
+
 type Post struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
@@ -38,6 +78,18 @@ type Post struct {
 	Description sql.NullString
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Guid        string
+	ContentHash sql.NullString
+	Revisions   int32
+	Author      sql.NullString
+	CommentsUrl sql.NullString
+	Content     sql.NullString
+	Undated     bool
+}
+
+type PostCategory struct {
+	PostID uuid.UUID
+	Name   string
 }
 
 type User struct {
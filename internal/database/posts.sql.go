@@ -7,56 +7,53 @@ package database
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+const getPostIDsByGuids = `-- name: GetPostIDsByGuids :many
+SELECT id, guid FROM posts
+WHERE feed_id = $1::uuid
+  AND guid = ANY($2::text[])
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+type GetPostIDsByGuidsParams struct {
+	FeedID uuid.UUID
+	Guids  []string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
-		arg.FeedID,
-	)
-	var i Post
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Title,
-		&i.Url,
-		&i.Description,
-		&i.PublishedAt,
-		&i.FeedID,
-	)
-	return i, err
+type GetPostIDsByGuidsRow struct {
+	ID   uuid.UUID
+	Guid string
+}
+
+func (q *Queries) GetPostIDsByGuids(ctx context.Context, arg GetPostIDsByGuidsParams) ([]GetPostIDsByGuidsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostIDsByGuids, arg.FeedID, pq.Array(arg.Guids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostIDsByGuidsRow
+	for rows.Next() {
+		var i GetPostIDsByGuidsRow
+		if err := rows.Scan(&i.ID, &i.Guid); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id FROM posts
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.revisions, posts.author, posts.comments_url, posts.content, posts.undated FROM posts
 INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 WHERE feed_follows.user_id = $1
 ORDER BY posts.published_at DESC
@@ -86,6 +83,142 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Revisions,
+			&i.Author,
+			&i.CommentsUrl,
+			&i.Content,
+			&i.Undated,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rekeyLegacyPosts = `-- name: RekeyLegacyPosts :exec
+UPDATE posts
+SET guid = items.guid
+FROM (SELECT unnest($2::text[]) AS url, unnest($3::text[]) AS guid) AS items
+WHERE posts.feed_id = $1::uuid
+  AND posts.guid = posts.url
+  AND posts.url = items.url
+  AND NOT EXISTS (SELECT 1 FROM posts AS taken WHERE taken.feed_id = posts.feed_id AND taken.guid = items.guid)
+`
+
+type RekeyLegacyPostsParams struct {
+	FeedID uuid.UUID
+	Urls   []string
+	Guids  []string
+}
+
+// Posts stored before guids existed got their url as guid. Gives them the key of the feed item with the same link,
+// so that the item updates the post instead of being stored a second time.
+func (q *Queries) RekeyLegacyPosts(ctx context.Context, arg RekeyLegacyPostsParams) error {
+	_, err := q.db.ExecContext(ctx, rekeyLegacyPosts, arg.FeedID, pq.Array(arg.Urls), pq.Array(arg.Guids))
+	return err
+}
+
+const upsertPosts = `-- name: UpsertPosts :many
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, author, comments_url, content, undated)
+SELECT
+    unnest($1::uuid[]),
+    $2::timestamp,
+    $2::timestamp,
+    unnest($3::text[]),
+    unnest($4::text[]),
+    unnest($5::text[]),
+    unnest($6::text[])::timestamp,
+    $7::uuid,
+    unnest($8::text[]),
+    unnest($9::text[]),
+    NULLIF(unnest($10::text[]), ''),
+    NULLIF(unnest($11::text[]), ''),
+    NULLIF(unnest($12::text[]), ''),
+    unnest($13::bool[])
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    -- an undated post keeps the fetch time it was first stored with
+    published_at = CASE WHEN EXCLUDED.undated THEN posts.published_at ELSE EXCLUDED.published_at END,
+    undated = EXCLUDED.undated AND posts.undated,
+    author = EXCLUDED.author,
+    comments_url = EXCLUDED.comments_url,
+    content = EXCLUDED.content,
+    updated_at = EXCLUDED.updated_at,
+    content_hash = EXCLUDED.content_hash,
+    revisions = posts.revisions + CASE WHEN posts.content_hash IS NULL THEN 0 ELSE 1 END
+WHERE posts.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, revisions, author, comments_url, content, undated
+`
+
+type UpsertPostsParams struct {
+	Ids           []uuid.UUID
+	CreatedAt     time.Time
+	Titles        []string
+	Urls          []string
+	Descriptions  []string
+	PublishedAts  []string
+	FeedID        uuid.UUID
+	Guids         []string
+	ContentHashes []string
+	Authors       []string
+	CommentsUrls  []string
+	Contents      []string
+	Undated       []bool
+}
+
+// Inserts the posts of a feed in a single statement, updating the stored posts whose content changed.
+// Only inserted and updated posts are returned. Posts stored before content hashes existed
+// only get their hash filled in, without counting a revision.
+func (q *Queries) UpsertPosts(ctx context.Context, arg UpsertPostsParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, upsertPosts,
+		pq.Array(arg.Ids),
+		arg.CreatedAt,
+		pq.Array(arg.Titles),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.PublishedAts),
+		arg.FeedID,
+		pq.Array(arg.Guids),
+		pq.Array(arg.ContentHashes),
+		pq.Array(arg.Authors),
+		pq.Array(arg.CommentsUrls),
+		pq.Array(arg.Contents),
+		pq.Array(arg.Undated),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Revisions,
+			&i.Author,
+			&i.CommentsUrl,
+			&i.Content,
+			&i.Undated,
 		); err != nil {
 			return nil, err
 		}
@@ -0,0 +1,136 @@
+package rss
+
+import (
+	"strings"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// atomFeed is the root <feed> element of an Atom 1.0 document.
+type atomFeed struct {
+	Title    atomText    `xml:"title"`
+	Subtitle atomText    `xml:"subtitle"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      atomText       `xml:"title"`
+	Links      []atomLink     `xml:"link"`
+	Summary    atomText       `xml:"summary"`
+	Content    atomText       `xml:"content"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomPerson   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// atomText is an Atom text construct. xhtml content is kept as markup, text and html are kept as character data.
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Body  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t atomText) String() string {
+	if t.Type == "xhtml" {
+		return t.Inner
+	}
+	return t.Body
+}
+
+// toFeed maps the Atom document into the common Feed model.
+func (a *atomFeed) toFeed() *Feed {
+	var feed Feed
+	feed.Channel.Title = a.Title.String()
+	feed.Channel.Link = alternateLink(a.Links)
+	feed.Channel.Description = a.Subtitle.String()
+
+	for _, entry := range a.Entries {
+		description := entry.Summary.String()
+		if description == "" {
+			description = entry.Content.String()
+		}
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+		var authors, categories []string
+		for _, author := range entry.Authors {
+			if name := strings.TrimSpace(author.Name); name != "" {
+				authors = append(authors, name)
+			}
+		}
+		for _, category := range entry.Categories {
+			if category.Label != "" {
+				categories = append(categories, category.Label)
+			} else {
+				categories = append(categories, category.Term)
+			}
+		}
+		feed.Channel.Item = append(feed.Channel.Item, Item{
+			GUID:        entry.ID,
+			Title:       entry.Title.String(),
+			Link:        alternateLink(entry.Links),
+			Description: description,
+			PubDate:     pubDate,
+			Author:      strings.Join(authors, ", "),
+			Categories:  cleanCategories(categories),
+			Content:     entry.Content.String(),
+			Comments:    repliesLink(entry.Links),
+			Enclosures:  enclosureLinks(entry.Links),
+		})
+	}
+	return &feed
+}
+
+// repliesLink returns the href of the link to the entry's comments, if any.
+func repliesLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "replies" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// enclosureLinks returns the entry's links to media files.
+func enclosureLinks(links []atomLink) []Enclosure {
+	var enclosures []Enclosure
+	for _, link := range links {
+		if link.Rel == "enclosure" && link.Href != "" {
+			enclosures = append(enclosures, Enclosure{URL: link.Href, Length: link.Length, Type: link.Type})
+		}
+	}
+	return enclosures
+}
+
+// alternateLink returns the href of the alternate link, falling back to the first link when none is marked as such.
+func alternateLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package rss
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// xmlEncoding matches the encoding declaration of an XML prolog.
+var xmlEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// sniffLen is how much of the document is inspected to find its charset and format.
+const sniffLen = 1024
+
+// utf8Reader returns a reader transcoding the document read from r to UTF-8. head holds the start of the document.
+// The charset is taken from the Content-Type header, then from the encoding declared in the XML prolog;
+// documents declaring neither are expected to be UTF-8.
+func utf8Reader(r io.Reader, head []byte, contentType string) (io.Reader, error) {
+	label := contentTypeCharset(contentType)
+	if label == "" {
+		label = prologEncoding(head)
+	}
+	if label == "" {
+		return r, nil
+	}
+
+	enc, name := charset.Lookup(label)
+	if enc == nil {
+		return nil, fmt.Errorf("unsupported charset: %q", label)
+	}
+	if name == "utf-8" {
+		return r, nil
+	}
+	return enc.NewDecoder().Reader(r), nil
+}
+
+// contentTypeCharset returns the charset parameter of a Content-Type header, if any.
+func contentTypeCharset(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(params["charset"])
+}
+
+// prologEncoding returns the encoding declared by the XML prolog, if any.
+func prologEncoding(data []byte) string {
+	match := xmlEncoding.FindSubmatch(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
+
+// utf8CharsetReader is the xml.Decoder CharsetReader for documents already transcoded by utf8Reader,
+// whose prolog may still declare their original encoding.
+func utf8CharsetReader(_ string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
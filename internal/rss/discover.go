@@ -0,0 +1,193 @@
+package rss
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Candidate is a feed found by Discover.
+type Candidate struct {
+	URL   string
+	Title string
+	// Type is the media type advertised by the page, empty for feeds found by probing common paths.
+	Type string
+}
+
+// ErrNoFeedsFound is returned by Discover when the page neither is a feed nor links to one.
+var ErrNoFeedsFound = errors.New("no feeds found")
+
+// feedTypes are the media types of the alternate links that point to feeds.
+var feedTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/feed+json",
+	"application/rdf+xml",
+}
+
+// commonFeedPaths are probed, relative to the site root, when a page does not link to its feeds.
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/feed.xml", "/index.xml"}
+
+// Discover finds the feeds of a website. When pageURL is a feed it is returned as the only candidate,
+// otherwise the page's <link rel="alternate"> tags are used, then common feed paths are tried.
+func (f *Fetcher) Discover(ctx context.Context, pageURL string) ([]Candidate, error) {
+	doc, err := f.get(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if !isHTML(doc.contentType) {
+		if feed, err := parseFeed(bytes.NewReader(doc.body), doc.contentType); err == nil {
+			mediaType, _, _ := mime.ParseMediaType(doc.contentType)
+			return []Candidate{{URL: doc.feedURL(pageURL), Title: feed.Channel.Title, Type: mediaType}}, nil
+		}
+	}
+
+	candidates := feedLinks(doc.body, doc.url)
+	if len(candidates) > 0 {
+		return candidates, nil
+	}
+
+	for _, path := range commonFeedPaths {
+		probeURL := doc.url.ResolveReference(&url.URL{Path: path}).String()
+		probe, err := f.get(ctx, probeURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if isHTML(probe.contentType) {
+			// sites often answer unknown paths with their home page
+			continue
+		}
+		if feed, err := parseFeed(bytes.NewReader(probe.body), probe.contentType); err == nil {
+			candidates = append(candidates, Candidate{URL: probe.feedURL(probeURL), Title: feed.Channel.Title})
+			// the paths are usually aliases of the same feed
+			break
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoFeedsFound
+	}
+	return candidates, nil
+}
+
+// document is a page downloaded by Fetcher.get.
+type document struct {
+	// url is where the document was found after following redirects, relative links resolve against it.
+	url *url.URL
+	// movedTo is the url the request was permanently redirected to, if any.
+	movedTo     string
+	contentType string
+	body        []byte
+}
+
+// feedURL returns the url to store for a document found to be a feed when requesting requestURL:
+// temporary redirects are not followed, like FetchFeed does for a feed's url.
+func (d *document) feedURL(requestURL string) string {
+	return cmp.Or(d.movedTo, requestURL)
+}
+
+// get downloads the document at pageURL, following redirects. The body is read up to the fetcher's size limit.
+func (f *Fetcher) get(ctx context.Context, pageURL string) (*document, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.waitTurn(ctx, hostKey(req.URL)); err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := io.ReadAll(&sizeLimitReader{r: resp.Body, limit: f.maxBytes})
+	if err != nil {
+		return nil, err
+	}
+	return &document{
+		url:         resp.Request.URL,
+		movedTo:     permanentRedirect(resp),
+		contentType: resp.Header.Get("Content-Type"),
+		body:        body,
+	}, nil
+}
+
+// isHTML reports whether the content type is an HTML page.
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// feedLinks returns the feeds linked from the <head> of an HTML page, resolving their urls against base
+// or the page's <base href>.
+func feedLinks(body []byte, base *url.URL) []Candidate {
+	var candidates []Candidate
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return candidates
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				// feed links belong in the head
+				return candidates
+			case "base":
+				if href := attr(token, "href"); href != "" {
+					if u, err := base.Parse(href); err == nil {
+						base = u
+					}
+				}
+			case "link":
+				rels := strings.Fields(strings.ToLower(attr(token, "rel")))
+				mediaType, _, _ := mime.ParseMediaType(attr(token, "type"))
+				href := strings.TrimSpace(attr(token, "href"))
+				if !slices.Contains(rels, "alternate") || !slices.Contains(feedTypes, mediaType) || href == "" {
+					continue
+				}
+				link, err := base.Parse(href)
+				if err != nil {
+					continue
+				}
+				if slices.ContainsFunc(candidates, func(c Candidate) bool { return c.URL == link.String() }) {
+					continue
+				}
+				candidates = append(candidates, Candidate{
+					URL:   link.String(),
+					Title: strings.TrimSpace(attr(token, "title")),
+					Type:  mediaType,
+				})
+			}
+		}
+	}
+}
+
+// attr returns the value of the token's attribute with the given name.
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
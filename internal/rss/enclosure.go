@@ -0,0 +1,48 @@
+package rss
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Enclosure is a media file attached to an item, such as a podcast episode.
+type Enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Size returns the advertised length of the enclosure in bytes, or 0 when it is missing or invalid.
+func (e Enclosure) Size() int64 {
+	size, err := strconv.ParseInt(strings.TrimSpace(e.Length), 10, 64)
+	if err != nil || size < 0 {
+		return 0
+	}
+	return size
+}
+
+// ITunesImage is the <itunes:image> element, which carries its URL in the href attribute.
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// DurationSeconds parses the item's itunes:duration, given either as seconds or as [HH:]MM:SS.
+// It returns 0 when the duration is missing or invalid.
+func (i Item) DurationSeconds() int32 {
+	parts := strings.Split(strings.TrimSpace(i.Duration), ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	var seconds int64
+	for _, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 32)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	if seconds > 1<<31-1 {
+		return 0
+	}
+	return int32(seconds)
+}
@@ -0,0 +1,193 @@
+package rss
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Defaults used for the FetcherOptions fields left at their zero value.
+const (
+	DefaultTimeout      = 30 * time.Second
+	DefaultUserAgent    = "gator"
+	DefaultMaxRedirects = 10
+	DefaultRetries      = 2
+	DefaultRetryDelay   = time.Second
+	DefaultMaxBytes     = 10 << 20
+	DefaultHostRate     = 1.0
+	DefaultHostBurst    = 5
+)
+
+// FetcherOptions configures a Fetcher. Zero values and nil pointers select the defaults; a MaxRedirects or Retries
+// of 0 disables redirects or retries, and a negative HostRate disables rate limiting.
+type FetcherOptions struct {
+	// Timeout bounds a whole attempt, including reading the body. Downloads made with Do are only bounded
+	// while waiting for the response headers.
+	Timeout time.Duration
+	// ProxyURL is the proxy requests go through. When empty, the proxy environment variables are used.
+	ProxyURL     string
+	UserAgent    string
+	MaxRedirects *int
+	// Retries is how many times a request answered with 429 or a 5xx status is retried.
+	// Attempt n waits RetryDelay * 2^n, with jitter.
+	Retries    *int
+	RetryDelay time.Duration
+	MaxBytes   int64
+	// HostRate is how many requests per second are made to a single host, after an initial burst of HostBurst.
+	HostRate  float64
+	HostBurst int
+}
+
+// Fetcher downloads and parses feeds over HTTP.
+type Fetcher struct {
+	client *http.Client
+	// downloads is client without the timeout, for files that may take longer to download than a feed.
+	downloads  *http.Client
+	userAgent  string
+	retries    int
+	retryDelay time.Duration
+	maxBytes   int64
+	limiter    *hostLimiter
+}
+
+// NewFetcher creates a Fetcher with its own HTTP client configured from opts.
+func NewFetcher(opts FetcherOptions) (*Fetcher, error) {
+	timeout := DefaultTimeout
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// the client timeout does not apply to downloads, a server that does not answer must not hang them
+	transport.ResponseHeaderTimeout = timeout
+	if opts.ProxyURL != "" {
+		proxy, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	maxRedirects := orDefault(opts.MaxRedirects, DefaultMaxRedirects)
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	downloads := *client
+	downloads.Timeout = 0
+
+	return &Fetcher{
+		client:     client,
+		downloads:  &downloads,
+		userAgent:  cmp.Or(opts.UserAgent, DefaultUserAgent),
+		retries:    orDefault(opts.Retries, DefaultRetries),
+		retryDelay: cmp.Or(opts.RetryDelay, DefaultRetryDelay),
+		maxBytes:   cmp.Or(max(opts.MaxBytes, 0), DefaultMaxBytes),
+		limiter:    newHostLimiter(cmp.Or(opts.HostRate, DefaultHostRate), cmp.Or(opts.HostBurst, DefaultHostBurst)),
+	}, nil
+}
+
+// orDefault returns the value v points to, at least 0, or def when v is nil.
+func orDefault(v *int, def int) int {
+	if v == nil {
+		return def
+	}
+	return max(*v, 0)
+}
+
+// StatusError is returned by FetchFeed when the server answers with an unexpected status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	// RetryAfter is the delay requested by the server's Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("failed to fetch feed: %s", e.Status)
+}
+
+// retryable reports whether the request may succeed if it is made again.
+func (e *StatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// FetchFeed downloads and parses the feed at feedURL. When cache holds validators from a previous fetch,
+// the request is made conditional and ErrNotModified is returned if the feed has not changed.
+// Requests answered with 429 or a 5xx status are retried with a jittered exponential backoff, unless the server
+// sent a Retry-After header: the error is returned and further requests to the host fail until that time.
+// Requests to a host are rate limited, FetchFeed waits for its turn unless it comes after ctx's deadline.
+func (f *Fetcher) FetchFeed(ctx context.Context, feedURL string, cache CacheHeaders) (*Feed, error) {
+	for attempt := 0; ; attempt++ {
+		feed, err := f.fetchOnce(ctx, feedURL, cache)
+		var statusErr *StatusError
+		if err == nil || !errors.As(err, &statusErr) || !statusErr.retryable() || statusErr.RetryAfter > 0 ||
+			attempt >= f.retries {
+			return feed, err
+		}
+		if sleep(ctx, f.retryBackoff(attempt)) != nil {
+			return nil, err
+		}
+	}
+}
+
+// Do sends req with the fetcher's proxy, user agent and redirect limit, for downloads other than feeds such as
+// podcast episodes. The timeout only applies until the response headers arrive, a large file may take long
+// to download: cancel req's context to stop it.
+func (f *Fetcher) Do(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	return f.downloads.Do(req)
+}
+
+// waitTurn waits until the rate limit of host allows another request. When the turn comes after ctx's deadline,
+// it returns a *RateLimitedError right away instead, with the time left until the turn as RetryAfter.
+func (f *Fetcher) waitTurn(ctx context.Context, host string) error {
+	now := time.Now()
+	wait, err := f.limiter.reserve(host, now)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+		f.limiter.cancel(host)
+		return &RateLimitedError{Host: host, RetryAfter: wait}
+	}
+	return sleep(ctx, wait)
+}
+
+// hostKey returns the name requests to u are rate limited under.
+func hostKey(u *url.URL) string {
+	return strings.ToLower(u.Hostname())
+}
+
+// sleep waits for d, returning early with the context's error when it is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryBackoff returns how long to wait before retrying after the given attempt:
+// a random duration between half and all of RetryDelay * 2^attempt.
+func (f *Fetcher) retryBackoff(attempt int) time.Duration {
+	delay := f.retryDelay << min(attempt, 16)
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,143 @@
+package rss
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const jsonFeedVersionPrefix = "https://jsonfeed.org/version/"
+
+// jsonFeed is a JSON Feed document, version 1.0 or 1.1.
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Description string         `json:"description"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	ExternalURL   string           `json:"external_url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Image         string           `json:"image"`
+	Tags          []string         `json:"tags"`
+	Attachments   []jsonAttachment `json:"attachments"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+	Author        *jsonFeedAuthor  `json:"author"` // version 1.0
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type jsonAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+// parseJSONFeed decodes a JSON Feed document into the common Feed model.
+func parseJSONFeed(r io.Reader) (*Feed, error) {
+	var doc jsonFeed
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(doc.Version, jsonFeedVersionPrefix) {
+		return nil, fmt.Errorf("unsupported JSON feed version: %q", doc.Version)
+	}
+	return doc.toFeed(), nil
+}
+
+// toFeed maps the JSON Feed document into the common Feed model.
+func (j *jsonFeed) toFeed() *Feed {
+	var feed Feed
+	feed.Channel.Title = j.Title
+	feed.Channel.Link = j.HomePageURL
+	feed.Channel.Description = j.Description
+
+	for _, item := range j.Items {
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+		description := item.ContentHTML
+		if description == "" {
+			description = item.ContentText
+		}
+		if description == "" {
+			description = item.Summary
+		}
+		pubDate := item.DatePublished
+		if pubDate == "" {
+			pubDate = item.DateModified
+		}
+		feed.Channel.Item = append(feed.Channel.Item, Item{
+			GUID:        item.ID,
+			Title:       item.Title,
+			Link:        link,
+			Description: description,
+			PubDate:     pubDate,
+			Author:      item.authorNames(),
+			Categories:  cleanCategories(item.Tags),
+			Content:     cmp.Or(item.ContentHTML, item.ContentText),
+			Enclosures:  item.enclosures(),
+			Duration:    item.duration(),
+			Image:       ITunesImage{Href: item.Image},
+		})
+	}
+	return &feed
+}
+
+// enclosures maps the item's attachments to enclosures.
+func (i jsonFeedItem) enclosures() []Enclosure {
+	var enclosures []Enclosure
+	for _, attachment := range i.Attachments {
+		if attachment.URL == "" {
+			continue
+		}
+		enclosure := Enclosure{URL: attachment.URL, Type: attachment.MimeType}
+		if attachment.SizeInBytes > 0 {
+			enclosure.Length = strconv.FormatInt(attachment.SizeInBytes, 10)
+		}
+		enclosures = append(enclosures, enclosure)
+	}
+	return enclosures
+}
+
+// duration returns the duration of the first attachment that has one, in seconds.
+func (i jsonFeedItem) duration() string {
+	for _, attachment := range i.Attachments {
+		if attachment.DurationInSeconds > 0 {
+			return strconv.FormatInt(int64(attachment.DurationInSeconds), 10)
+		}
+	}
+	return ""
+}
+
+// authorNames joins the item's author names, accepting both the 1.1 authors list and the 1.0 author object.
+func (i jsonFeedItem) authorNames() string {
+	authors := i.Authors
+	if len(authors) == 0 && i.Author != nil {
+		authors = []jsonFeedAuthor{*i.Author}
+	}
+	names := make([]string, 0, len(authors))
+	for _, author := range authors {
+		if author.Name != "" {
+			names = append(names, author.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
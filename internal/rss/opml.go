@@ -0,0 +1,117 @@
+package rss
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Subscription is a feed listed in an OPML document.
+type Subscription struct {
+	URL   string
+	Title string
+	// Categories are the folders the feed is filed under, nested folders joined with "/",
+	// and the categories given by the outline's category attribute.
+	Categories []string
+}
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Body    struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+type opmlOutline struct {
+	// Attrs holds every attribute: exporters disagree on the case of names such as xmlUrl.
+	Attrs    []xml.Attr    `xml:",any,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// attr returns the value of the outline's attribute with the given name, ignoring case.
+func (o opmlOutline) attr(name string) string {
+	for _, a := range o.Attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return strings.TrimSpace(a.Value)
+		}
+	}
+	return ""
+}
+
+// ParseOPML reads the subscriptions of an OPML document, such as the export of another feed reader.
+// Outlines with an xmlUrl attribute are feeds, the others are folders. A feed listed several times is returned once,
+// with the categories of all its entries.
+func ParseOPML(r io.Reader) ([]Subscription, error) {
+	buffered := bufio.NewReader(r)
+	head, _ := buffered.Peek(sniffLen)
+	body, err := utf8Reader(buffered, head, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var doc opmlDocument
+	decoder := xml.NewDecoder(body)
+	decoder.CharsetReader = utf8CharsetReader
+	if err := decoder.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty opml document")
+		}
+		return nil, fmt.Errorf("invalid opml document: %w", err)
+	}
+
+	var subscriptions []Subscription
+	index := make(map[string]int)
+	var walk func(outlines []opmlOutline, folders []string)
+	walk = func(outlines []opmlOutline, folders []string) {
+		for _, outline := range outlines {
+			feedURL := outline.attr("xmlUrl")
+			if feedURL == "" {
+				title := outlineTitle(outline)
+				if title == "" {
+					walk(outline.Outlines, folders)
+					continue
+				}
+				walk(outline.Outlines, append(slices.Clip(folders), title))
+				continue
+			}
+
+			var categories []string
+			if len(folders) > 0 {
+				categories = append(categories, strings.Join(folders, "/"))
+			}
+			for _, category := range strings.Split(outline.attr("category"), ",") {
+				if category = strings.Trim(strings.TrimSpace(category), "/"); category != "" {
+					categories = append(categories, category)
+				}
+			}
+
+			i, ok := index[feedURL]
+			if !ok {
+				i = len(subscriptions)
+				index[feedURL] = i
+				subscriptions = append(subscriptions, Subscription{URL: feedURL, Title: outlineTitle(outline)})
+			}
+			for _, category := range categories {
+				if !slices.Contains(subscriptions[i].Categories, category) {
+					subscriptions[i].Categories = append(subscriptions[i].Categories, category)
+				}
+			}
+			// feeds rarely have children, but keep whatever they hold
+			walk(outline.Outlines, folders)
+		}
+	}
+	walk(doc.Body.Outlines, nil)
+	return subscriptions, nil
+}
+
+// outlineTitle returns the title of an outline, falling back to its text.
+func outlineTitle(o opmlOutline) string {
+	if title := o.attr("title"); title != "" {
+		return title
+	}
+	return o.attr("text")
+}
@@ -0,0 +1,126 @@
+package rss
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimiter is a token bucket per host: each host allows burst requests at once, refilled at rate per second.
+// A host that answered with Retry-After is blocked until that time.
+type hostLimiter struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*hostBucket
+}
+
+type hostBucket struct {
+	tokens       float64
+	updated      time.Time
+	blockedUntil time.Time
+}
+
+func newHostLimiter(rate float64, burst int) *hostLimiter {
+	return &hostLimiter{rate: rate, burst: burst, buckets: make(map[string]*hostBucket)}
+}
+
+// bucket returns the host's bucket, refilled up to now. The caller must hold l.mu.
+func (l *hostLimiter) bucket(host string, now time.Time) *hostBucket {
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &hostBucket{tokens: float64(l.burst), updated: now}
+		l.buckets[host] = b
+	}
+	if now.After(b.updated) {
+		b.tokens = min(float64(l.burst), b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+		b.updated = now
+	}
+	return b
+}
+
+// reserve takes a token for a request to host and returns how long the caller must wait before making it.
+// It returns a *RateLimitedError instead when the host is blocked.
+func (l *hostLimiter) reserve(host string, now time.Time) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(host, now)
+	if now.Before(b.blockedUntil) {
+		return 0, &RateLimitedError{Host: host, RetryAfter: b.blockedUntil.Sub(now)}
+	}
+	if l.rate <= 0 {
+		return 0, nil
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0, nil
+	}
+	return time.Duration(-b.tokens / l.rate * float64(time.Second)), nil
+}
+
+// cancel returns the token taken by a reservation for host that will not be used.
+func (l *hostLimiter) cancel(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[host]; ok && l.rate > 0 {
+		b.tokens = min(float64(l.burst), b.tokens+1)
+	}
+}
+
+// block stops requests to host until the given time.
+func (l *hostLimiter) block(host string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(host, time.Now())
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// RateLimitedError is returned by Fetcher.FetchFeed without making a request when the feed's host
+// asked to be left alone with a Retry-After header, or when its turn at the host comes after the context's deadline.
+type RateLimitedError struct {
+	Host       string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("host %s is rate limited for %s", e.Host, e.RetryAfter.Round(time.Second))
+}
+
+// RetryAfter returns how long the server asked to wait before the feed is fetched again, or 0 if it did not.
+func RetryAfter(err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	var rateLimitedErr *RateLimitedError
+	if errors.As(err, &rateLimitedErr) {
+		return rateLimitedErr.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header, given either as a number of seconds or as an HTTP date.
+// It returns 0 when the header is missing, invalid or in the past.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
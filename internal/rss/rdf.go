@@ -0,0 +1,50 @@
+package rss
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// rdfFeed is the root <rdf:RDF> element of an RSS 1.0 document. Unlike RSS 2.0, items are siblings of the channel.
+type rdfFeed struct {
+	Channel struct {
+		Title           string `xml:"title"`
+		Link            string `xml:"link"`
+		Description     string `xml:"description"`
+		UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+	} `xml:"channel"`
+	Items []rdfItem `xml:"item"`
+}
+
+type rdfItem struct {
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subjects    []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+// toFeed maps the RSS 1.0 document into the common Feed model, using dc:date as the publish date.
+func (r *rdfFeed) toFeed() *Feed {
+	var feed Feed
+	feed.Channel.Title = r.Channel.Title
+	feed.Channel.Link = r.Channel.Link
+	feed.Channel.Description = r.Channel.Description
+	feed.Channel.UpdatePeriod = r.Channel.UpdatePeriod
+	feed.Channel.UpdateFrequency = r.Channel.UpdateFrequency
+
+	for _, item := range r.Items {
+		feed.Channel.Item = append(feed.Channel.Item, Item{
+			GUID:        item.About,
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			PubDate:     item.Date,
+			Author:      item.Creator,
+			Categories:  cleanCategories(item.Subjects),
+			Content:     item.Content,
+		})
+	}
+	return &feed
+}
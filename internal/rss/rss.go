@@ -1,21 +1,37 @@
 package rss
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"html"
 	"io"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
 type Feed struct {
 	Channel struct {
-		Title       string `xml:"title"`
-		Link        string `xml:"link"`
-		Description string `xml:"description"`
-		Item        []Item `xml:"item"`
+		Title           string   `xml:"title"`
+		Link            string   `xml:"link"`
+		Description     string   `xml:"description"`
+		TTL             string   `xml:"ttl"`
+		UpdatePeriod    string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+		SkipHours       []string `xml:"skipHours>hour"`
+		SkipDays        []string `xml:"skipDays>day"`
+		Item            []Item   `xml:"item"`
 	} `xml:"channel"`
+	Cache CacheHeaders `xml:"-"`
+	// MovedTo is the url the feed permanently redirected to when it was fetched, if any.
+	MovedTo string `xml:"-"`
 }
 
 func (f *Feed) UnescapeString() {
@@ -25,43 +41,280 @@ func (f *Feed) UnescapeString() {
 	for i := range f.Channel.Item {
 		f.Channel.Item[i].Title = html.UnescapeString(f.Channel.Item[i].Title)
 		f.Channel.Item[i].Description = html.UnescapeString(f.Channel.Item[i].Description)
+		f.Channel.Item[i].Author = html.UnescapeString(f.Channel.Item[i].Author)
 	}
 }
 
+// normalize fills the common fields of RSS 2.0 items from their module equivalents: dc:creator is used as the author
+// when there is no <author>, and category names are trimmed.
+func (f *Feed) normalize() {
+	for i := range f.Channel.Item {
+		item := &f.Channel.Item[i]
+		if strings.TrimSpace(item.Author) == "" {
+			item.Author = item.Creator
+		}
+		item.Categories = cleanCategories(item.Categories)
+	}
+}
+
+// cleanCategories trims category names and drops empty and repeated ones.
+func cleanCategories(categories []string) []string {
+	var cleaned []string
+	for _, category := range categories {
+		category = strings.TrimSpace(category)
+		if category != "" && !slices.Contains(cleaned, category) {
+			cleaned = append(cleaned, category)
+		}
+	}
+	return cleaned
+}
+
 type Item struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	GUID        string   `xml:"guid"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	PubDate     string   `xml:"pubDate"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string `xml:"category"`
+	Comments    string   `xml:"comments"`
+	// Content is the full body of the item, when the feed publishes one besides the description.
+	Content    string      `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Enclosures []Enclosure `xml:"enclosure"`
+	// Duration and Image describe podcast episodes, from the iTunes namespace.
+	Duration string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	Image    ITunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+}
+
+// Key returns a stable identifier for the item within its feed: the guid, or the link when there is none,
+// or a hash of the item's content when it has neither.
+func (i Item) Key() string {
+	if guid := strings.TrimSpace(i.GUID); guid != "" {
+		return guid
+	}
+	if link := strings.TrimSpace(i.Link); link != "" {
+		return link
+	}
+	// the fields hashed here must not change, the key of stored posts depends on them
+	return "sha256:" + hashFields(i.Title, i.Description, i.PubDate)
+}
+
+// ContentHash returns a hex encoded SHA-256 hash of the stored fields of the item: title, description,
+// publish date, content, author, comments link and categories. The order of the categories does not matter.
+func (i Item) ContentHash() string {
+	fields := []string{i.Title, i.Description, i.PubDate, i.Content, i.Author, i.Comments}
+	return hashFields(append(fields, slices.Sorted(slices.Values(i.Categories))...)...)
+}
+
+// hashFields returns a hex encoded SHA-256 hash of the fields.
+func hashFields(fields ...string) string {
+	h := sha256.New()
+	for _, field := range fields {
+		h.Write([]byte(field))
+		// separate the fields so that moving text between them changes the hash
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CacheHeaders holds the validators returned by the server, sent back on the next fetch to make it conditional.
+type CacheHeaders struct {
+	ETag         string
+	LastModified string
+}
+
+// ErrNotModified is returned by Fetcher.FetchFeed when the server answers a conditional request with 304 Not Modified.
+var ErrNotModified = errors.New("feed not modified")
+
+// NotModifiedError is the error returned for 304 Not Modified responses, it matches ErrNotModified.
+// MovedTo is set when the request was permanently redirected before the server answered.
+type NotModifiedError struct {
+	MovedTo string
+}
+
+func (e *NotModifiedError) Error() string {
+	return ErrNotModified.Error()
 }
 
-func FetchFeed(ctx context.Context, feedURL string) (*Feed, error) {
+func (e *NotModifiedError) Is(target error) bool {
+	return target == ErrNotModified
+}
+
+// TooLargeError is returned by Fetcher.FetchFeed when the feed body is larger than the allowed size.
+type TooLargeError struct {
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("feed is larger than the limit of %d bytes", e.Limit)
+}
+
+// fetchOnce makes a single attempt at downloading and parsing the feed at feedURL.
+// The body is decoded while it is read; a *TooLargeError is returned once it exceeds the fetcher's size limit.
+func (f *Fetcher) fetchOnce(ctx context.Context, feedURL string, cache CacheHeaders) (*Feed, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", "gator")
+	host := hostKey(req.URL)
+	if err := f.waitTurn(ctx, host); err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	if cache.ETag != "" {
+		req.Header.Set("If-None-Match", cache.ETag)
+	}
+	if cache.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cache.LastModified)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := f.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(resp.Body)
+	movedTo := permanentRedirect(resp)
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, &NotModifiedError{MovedTo: movedTo}
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch feed: %s", resp.Status)
+		now := time.Now()
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+		if retryAfter > 0 {
+			f.limiter.block(host, now.Add(retryAfter))
+		}
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, RetryAfter: retryAfter}
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	if resp.ContentLength > f.maxBytes {
+		return nil, &TooLargeError{Limit: f.maxBytes}
+	}
+
+	body := &sizeLimitReader{r: resp.Body, limit: f.maxBytes}
+	feed, err := parseFeed(body, resp.Header.Get("Content-Type"))
+	if body.exceeded() {
+		// the decoder may report the read error as a syntax error
+		return nil, &TooLargeError{Limit: f.maxBytes}
+	}
 	if err != nil {
 		return nil, err
 	}
+	feed.Cache = CacheHeaders{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	feed.MovedTo = movedTo
+	return feed, nil
+}
+
+// permanentRedirect returns the url the request was moved to by the permanent redirects (301 and 308)
+// at the start of its redirect chain, or an empty string when it was not permanently redirected.
+func permanentRedirect(resp *http.Response) string {
+	// Walk the chain back from the last request, each request links to the redirect response that caused it
+	var chain []*http.Request
+	for req := resp.Request; req != nil; req = req.Response.Request {
+		chain = append(chain, req)
+		if req.Response == nil {
+			break
+		}
+	}
+	slices.Reverse(chain)
+
+	movedTo := ""
+	for _, req := range chain[1:] {
+		if code := req.Response.StatusCode; code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+			break
+		}
+		movedTo = req.URL.String()
+	}
+	return movedTo
+}
+
+// parseFeed transcodes the document to UTF-8, detects its format and decodes it into a Feed.
+// JSON Feed is recognized by its content type or leading brace, XML formats by their root element: <rss>, <rdf:RDF>
+// or an Atom <feed>. Other documents are rejected.
+func parseFeed(r io.Reader, contentType string) (*Feed, error) {
+	buffered := bufio.NewReader(r)
+	// the error is returned again by the first read if the document is unreadable
+	head, _ := buffered.Peek(sniffLen)
 
-	var feed Feed
-	err = xml.Unmarshal(data, &feed)
+	body, err := utf8Reader(buffered, head, contentType)
 	if err != nil {
 		return nil, err
 	}
-	return &feed, nil
+	if isJSON(head, contentType) {
+		return parseJSONFeed(body)
+	}
+
+	decoder := xml.NewDecoder(body)
+	decoder.CharsetReader = utf8CharsetReader
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("empty feed document")
+			}
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case start.Name.Local == "feed" && start.Name.Space == atomNamespace:
+			var atom atomFeed
+			if err := decoder.DecodeElement(&atom, &start); err != nil {
+				return nil, err
+			}
+			return atom.toFeed(), nil
+		case start.Name.Local == "RDF" && start.Name.Space == rdfNamespace:
+			var rdf rdfFeed
+			if err := decoder.DecodeElement(&rdf, &start); err != nil {
+				return nil, err
+			}
+			return rdf.toFeed(), nil
+		case start.Name.Local == "rss" && start.Name.Space == "":
+			var feed Feed
+			if err := decoder.DecodeElement(&feed, &start); err != nil {
+				return nil, err
+			}
+			feed.normalize()
+			return &feed, nil
+		default:
+			return nil, fmt.Errorf("not a feed: unexpected root element <%s>", start.Name.Local)
+		}
+	}
+}
+
+// isJSON reports whether the document starting with data should be parsed as JSON Feed.
+func isJSON(data []byte, contentType string) bool {
+	if strings.Contains(strings.ToLower(contentType), "json") {
+		return true
+	}
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// sizeLimitReader reads from r and fails with a *TooLargeError once more than limit bytes have been read.
+type sizeLimitReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.exceeded() {
+		return 0, &TooLargeError{Limit: l.limit}
+	}
+	return n, err
+}
+
+func (l *sizeLimitReader) exceeded() bool {
+	return l.read > l.limit
 }
@@ -0,0 +1,1146 @@
+package rss
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFeed(t *testing.T) {
+	t.Run("parses RSS 2.0 documents", func(t *testing.T) {
+		data := []byte(`<?xml version="1.0"?>
+<rss version="2.0">
+  <channel>
+    <title>Example</title>
+    <link>https://example.com/</link>
+    <description>An example feed</description>
+    <item>
+      <title>First post</title>
+      <link>https://example.com/first</link>
+      <description>Hello</description>
+      <pubDate>Mon, 02 Jan 2006 15:04:05 -0700</pubDate>
+    </item>
+  </channel>
+</rss>`)
+
+		feed, err := parseFeed(bytes.NewReader(data), "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if feed.Channel.Title != "Example" {
+			t.Errorf("expected title %q, got %q", "Example", feed.Channel.Title)
+		}
+		if len(feed.Channel.Item) != 1 {
+			t.Fatalf("expected 1 item, got %d", len(feed.Channel.Item))
+		}
+		if feed.Channel.Item[0].Link != "https://example.com/first" {
+			t.Errorf("expected link %q, got %q", "https://example.com/first", feed.Channel.Item[0].Link)
+		}
+	})
+
+	t.Run("captures RSS item metadata", func(t *testing.T) {
+		data := []byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+  <channel>
+    <title>Example</title>
+    <item>
+      <title>First post</title>
+      <link>https://example.com/first</link>
+      <dc:creator>Jane Doe</dc:creator>
+      <category>Go</category>
+      <category> Feeds </category>
+      <category>Go</category>
+      <comments>https://example.com/first#comments</comments>
+      <content:encoded><![CDATA[<p>Full body</p>]]></content:encoded>
+    </item>
+  </channel>
+</rss>`)
+
+		feed, err := parseFeed(bytes.NewReader(data), "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		item := feed.Channel.Item[0]
+		if item.Author != "Jane Doe" {
+			t.Errorf("expected author %q, got %q", "Jane Doe", item.Author)
+		}
+		if !slices.Equal(item.Categories, []string{"Go", "Feeds"}) {
+			t.Errorf("expected categories [Go Feeds], got %v", item.Categories)
+		}
+		if item.Comments != "https://example.com/first#comments" {
+			t.Errorf("expected comments %q, got %q", "https://example.com/first#comments", item.Comments)
+		}
+		if item.Content != "<p>Full body</p>" {
+			t.Errorf("expected content %q, got %q", "<p>Full body</p>", item.Content)
+		}
+	})
+
+	t.Run("captures podcast enclosures", func(t *testing.T) {
+		data := []byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+  <channel>
+    <title>Podcast</title>
+    <item>
+      <title>Episode 1</title>
+      <guid>ep1</guid>
+      <enclosure url="https://example.com/ep1.mp3" length="12345" type="audio/mpeg"/>
+      <itunes:duration>1:02:03</itunes:duration>
+      <itunes:image href="https://example.com/ep1.jpg"/>
+    </item>
+  </channel>
+</rss>`)
+
+		feed, err := parseFeed(bytes.NewReader(data), "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		item := feed.Channel.Item[0]
+		if len(item.Enclosures) != 1 {
+			t.Fatalf("expected 1 enclosure, got %d", len(item.Enclosures))
+		}
+		enclosure := item.Enclosures[0]
+		if enclosure.URL != "https://example.com/ep1.mp3" || enclosure.Type != "audio/mpeg" || enclosure.Size() != 12345 {
+			t.Errorf("unexpected enclosure %+v", enclosure)
+		}
+		if got := item.DurationSeconds(); got != 3723 {
+			t.Errorf("expected duration 3723s, got %d", got)
+		}
+		if item.Image.Href != "https://example.com/ep1.jpg" {
+			t.Errorf("expected image %q, got %q", "https://example.com/ep1.jpg", item.Image.Href)
+		}
+	})
+
+	t.Run("transcodes documents declaring a legacy charset", func(t *testing.T) {
+		// "Café – déjà vu" in ISO-8859-1, with a Windows-1252 en dash
+		title := "Caf\xe9 \x96 d\xe9j\xe0 vu"
+		tests := []struct {
+			name        string
+			prolog      string
+			contentType string
+		}{
+			{"from the XML prolog", `<?xml version="1.0" encoding="ISO-8859-1"?>`, "application/rss+xml"},
+			{"from the Content-Type header", `<?xml version="1.0"?>`, "application/rss+xml; charset=windows-1252"},
+			{"preferring the Content-Type header", `<?xml version="1.0" encoding="utf-8"?>`, "text/xml; charset=iso-8859-1"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				data := []byte(tt.prolog + `<rss version="2.0"><channel><title>` + title + `</title></channel></rss>`)
+				feed, err := parseFeed(bytes.NewReader(data), tt.contentType)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if want := "Café – déjà vu"; feed.Channel.Title != want {
+					t.Errorf("expected title %q, got %q", want, feed.Channel.Title)
+				}
+			})
+		}
+	})
+
+	t.Run("returns an error for unknown charsets", func(t *testing.T) {
+		data := []byte(`<?xml version="1.0" encoding="x-unknown"?><rss version="2.0"><channel></channel></rss>`)
+		if _, err := parseFeed(bytes.NewReader(data), ""); err == nil {
+			t.Fatal("expected error for unknown charset")
+		}
+	})
+
+	t.Run("parses Atom 1.0 documents", func(t *testing.T) {
+		data := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Atom Example</title>
+  <subtitle>An Atom feed</subtitle>
+  <link rel="self" href="https://example.com/atom.xml"/>
+  <link href="https://example.com/"/>
+  <entry>
+    <id>urn:uuid:1</id>
+    <title>Summary entry</title>
+    <link rel="edit" href="https://example.com/edit/1"/>
+    <link rel="alternate" href="https://example.com/1"/>
+    <summary>Short summary</summary>
+    <content type="html">&lt;p&gt;Full content&lt;/p&gt;</content>
+    <updated>2024-01-02T10:00:00Z</updated>
+    <published>2024-01-01T10:00:00Z</published>
+  </entry>
+  <entry>
+    <id>urn:uuid:2</id>
+    <title>Content entry</title>
+    <link href="https://example.com/2"/>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Body</p></div></content>
+    <updated>2024-01-03T10:00:00Z</updated>
+  </entry>
+</feed>`)
+
+		feed, err := parseFeed(bytes.NewReader(data), "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if feed.Channel.Title != "Atom Example" {
+			t.Errorf("expected title %q, got %q", "Atom Example", feed.Channel.Title)
+		}
+		if feed.Channel.Link != "https://example.com/" {
+			t.Errorf("expected link %q, got %q", "https://example.com/", feed.Channel.Link)
+		}
+		if len(feed.Channel.Item) != 2 {
+			t.Fatalf("expected 2 items, got %d", len(feed.Channel.Item))
+		}
+
+		first := feed.Channel.Item[0]
+		if first.Link != "https://example.com/1" {
+			t.Errorf("expected alternate link, got %q", first.Link)
+		}
+		if first.Description != "Short summary" {
+			t.Errorf("expected summary as description, got %q", first.Description)
+		}
+		if first.PubDate != "2024-01-01T10:00:00Z" {
+			t.Errorf("expected published date, got %q", first.PubDate)
+		}
+
+		second := feed.Channel.Item[1]
+		if second.Description != `<div xmlns="http://www.w3.org/1999/xhtml"><p>Body</p></div>` {
+			t.Errorf("expected xhtml content as description, got %q", second.Description)
+		}
+		if second.PubDate != "2024-01-03T10:00:00Z" {
+			t.Errorf("expected updated date as fallback, got %q", second.PubDate)
+		}
+	})
+
+	t.Run("parses JSON Feed documents", func(t *testing.T) {
+		data := []byte(`{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "JSON Example",
+  "home_page_url": "https://example.com/",
+  "items": [
+    {
+      "id": "1",
+      "url": "https://example.com/1",
+      "title": "HTML item",
+      "content_html": "<p>Hello</p>",
+      "content_text": "Hello",
+      "date_published": "2024-01-01T10:00:00Z",
+      "authors": [{"name": "Ada"}, {"name": "Grace"}]
+    },
+    {
+      "id": "2",
+      "external_url": "https://elsewhere.example.com/2",
+      "content_text": "Plain",
+      "date_modified": "2024-01-02T10:00:00Z",
+      "author": {"name": "Linus"}
+    }
+  ]
+}`)
+
+		feed, err := parseFeed(bytes.NewReader(data), "application/feed+json")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if feed.Channel.Title != "JSON Example" {
+			t.Errorf("expected title %q, got %q", "JSON Example", feed.Channel.Title)
+		}
+		if len(feed.Channel.Item) != 2 {
+			t.Fatalf("expected 2 items, got %d", len(feed.Channel.Item))
+		}
+
+		first := feed.Channel.Item[0]
+		if first.Description != "<p>Hello</p>" {
+			t.Errorf("expected html content as description, got %q", first.Description)
+		}
+		if first.Author != "Ada, Grace" {
+			t.Errorf("expected authors %q, got %q", "Ada, Grace", first.Author)
+		}
+
+		second := feed.Channel.Item[1]
+		if second.Link != "https://elsewhere.example.com/2" {
+			t.Errorf("expected external url as link, got %q", second.Link)
+		}
+		if second.Description != "Plain" {
+			t.Errorf("expected text content as description, got %q", second.Description)
+		}
+		if second.PubDate != "2024-01-02T10:00:00Z" {
+			t.Errorf("expected modified date as fallback, got %q", second.PubDate)
+		}
+		if second.Author != "Linus" {
+			t.Errorf("expected version 1.0 author %q, got %q", "Linus", second.Author)
+		}
+	})
+
+	t.Run("sniffs JSON Feed without a content type", func(t *testing.T) {
+		data := []byte(` {"version": "https://jsonfeed.org/version/1", "title": "Sniffed", "items": []}`)
+
+		feed, err := parseFeed(bytes.NewReader(data), "text/plain")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if feed.Channel.Title != "Sniffed" {
+			t.Errorf("expected title %q, got %q", "Sniffed", feed.Channel.Title)
+		}
+	})
+
+	t.Run("parses RSS 1.0 documents", func(t *testing.T) {
+		data := []byte(`<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+         xmlns="http://purl.org/rss/1.0/"
+         xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel rdf:about="https://example.org/">
+    <title>RDF Example</title>
+    <link>https://example.org/</link>
+    <description>An RSS 1.0 feed</description>
+    <items>
+      <rdf:Seq>
+        <rdf:li rdf:resource="https://example.org/report"/>
+      </rdf:Seq>
+    </items>
+  </channel>
+  <item rdf:about="https://example.org/report">
+    <title>Annual report</title>
+    <link>https://example.org/report</link>
+    <description>Published today</description>
+    <dc:date>2024-03-01T09:30:00+01:00</dc:date>
+    <dc:creator>Statistics Office</dc:creator>
+  </item>
+</rdf:RDF>`)
+
+		feed, err := parseFeed(bytes.NewReader(data), "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if feed.Channel.Title != "RDF Example" {
+			t.Errorf("expected title %q, got %q", "RDF Example", feed.Channel.Title)
+		}
+		if len(feed.Channel.Item) != 1 {
+			t.Fatalf("expected 1 item, got %d", len(feed.Channel.Item))
+		}
+
+		item := feed.Channel.Item[0]
+		if item.Link != "https://example.org/report" {
+			t.Errorf("expected link %q, got %q", "https://example.org/report", item.Link)
+		}
+		if item.PubDate != "2024-03-01T09:30:00+01:00" {
+			t.Errorf("expected dc:date as publish date, got %q", item.PubDate)
+		}
+		if item.Author != "Statistics Office" {
+			t.Errorf("expected dc:creator as author, got %q", item.Author)
+		}
+	})
+
+	t.Run("rejects empty documents", func(t *testing.T) {
+		if _, err := parseFeed(strings.NewReader("   "), ""); err == nil {
+			t.Fatal("expected error for empty document")
+		}
+	})
+
+	t.Run("rejects XML documents that are not feeds", func(t *testing.T) {
+		documents := []string{
+			`<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>https://example.com/</loc></url></urlset>`,
+			`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Blog</title></head><body></body></html>`,
+			`<feed><title>Not Atom</title></feed>`,
+		}
+		for _, document := range documents {
+			if _, err := parseFeed(strings.NewReader(document), "application/xml"); err == nil {
+				t.Errorf("expected error for %s", document)
+			}
+		}
+	})
+}
+
+func TestFetchFeed(t *testing.T) {
+	const body = `<rss version="2.0"><channel><title>Cached</title></channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 10:00:00 GMT")
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	t.Run("returns cache headers from the response", func(t *testing.T) {
+		feed, err := newTestFetcher(t, FetcherOptions{}).FetchFeed(context.Background(), server.URL, CacheHeaders{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if feed.Cache.ETag != `"v1"` {
+			t.Errorf("expected etag %q, got %q", `"v1"`, feed.Cache.ETag)
+		}
+		if feed.Cache.LastModified != "Mon, 01 Jan 2024 10:00:00 GMT" {
+			t.Errorf("expected last modified header, got %q", feed.Cache.LastModified)
+		}
+	})
+
+	t.Run("returns ErrNotModified for a 304 response", func(t *testing.T) {
+		_, err := newTestFetcher(t, FetcherOptions{}).FetchFeed(context.Background(), server.URL, CacheHeaders{ETag: `"v1"`})
+		if !errors.Is(err, ErrNotModified) {
+			t.Fatalf("expected ErrNotModified, got %v", err)
+		}
+	})
+
+	t.Run("returns a TooLargeError for feeds over the limit", func(t *testing.T) {
+		large := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Large</title>`))
+			// stream the items so that the response has no Content-Length
+			w.(http.Flusher).Flush()
+			for range 1000 {
+				_, _ = w.Write([]byte(`<item><title>Filler</title></item>`))
+			}
+			_, _ = w.Write([]byte(`</channel></rss>`))
+		}))
+		defer large.Close()
+
+		_, err := newTestFetcher(t, FetcherOptions{MaxBytes: 4096}).FetchFeed(context.Background(), large.URL, CacheHeaders{})
+		var tooLarge *TooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Fatalf("expected TooLargeError, got %v", err)
+		}
+		if tooLarge.Limit != 4096 {
+			t.Errorf("expected limit 4096, got %d", tooLarge.Limit)
+		}
+	})
+
+	t.Run("rejects feeds whose Content-Length is over the limit", func(t *testing.T) {
+		_, err := newTestFetcher(t, FetcherOptions{MaxBytes: 16}).FetchFeed(context.Background(), server.URL, CacheHeaders{})
+		var tooLarge *TooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Fatalf("expected TooLargeError, got %v", err)
+		}
+	})
+}
+
+func TestPermanentRedirects(t *testing.T) {
+	const body = `<rss version="2.0"><channel><title>Moved</title></channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/older":
+			http.Redirect(w, r, "/old", http.StatusPermanentRedirect)
+		case "/temporary":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		case "/temporary-then-moved":
+			http.Redirect(w, r, "/old", http.StatusTemporaryRedirect)
+		case "/new":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		}
+	}))
+	defer server.Close()
+	fetcher := newTestFetcher(t, FetcherOptions{HostRate: -1})
+
+	tests := []struct {
+		path    string
+		movedTo string
+	}{
+		{"/new", ""},
+		{"/old", server.URL + "/new"},
+		{"/older", server.URL + "/new"},
+		{"/temporary", ""},
+		{"/temporary-then-moved", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			feed, err := fetcher.FetchFeed(context.Background(), server.URL+tt.path, CacheHeaders{})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if feed.MovedTo != tt.movedTo {
+				t.Errorf("expected moved to %q, got %q", tt.movedTo, feed.MovedTo)
+			}
+		})
+	}
+
+	t.Run("reports the move of a feed that was not modified", func(t *testing.T) {
+		_, err := fetcher.FetchFeed(context.Background(), server.URL+"/old", CacheHeaders{ETag: `"v1"`})
+		if !errors.Is(err, ErrNotModified) {
+			t.Fatalf("expected ErrNotModified, got %v", err)
+		}
+		var notModified *NotModifiedError
+		if !errors.As(err, &notModified) || notModified.MovedTo != server.URL+"/new" {
+			t.Errorf("expected NotModifiedError moved to %q, got %v", server.URL+"/new", err)
+		}
+	})
+}
+
+func TestDiscover(t *testing.T) {
+	const feed = `<rss version="2.0"><channel><title>Blog</title></channel></rss>`
+	newServer := func(pages map[string]string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, ok := pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			if strings.HasPrefix(body, "<rss") {
+				w.Header().Set("Content-Type", "application/rss+xml")
+			} else {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+	}
+	fetcher := newTestFetcher(t, FetcherOptions{HostRate: -1})
+
+	t.Run("finds the feeds linked from the page head", func(t *testing.T) {
+		server := newServer(map[string]string{
+			"/blog/": `<html><head>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="Posts" href="feed.xml">
+<link rel="alternate" type="application/atom+xml" title="Atom" href="/atom.xml">
+<link rel="alternate" type="application/rss+xml" href="feed.xml">
+<link rel="alternate" hreflang="fr" href="/fr/">
+</head><body><link rel="alternate" type="application/rss+xml" href="/ignored.xml"></body></html>`,
+		})
+		defer server.Close()
+
+		candidates, err := fetcher.Discover(context.Background(), server.URL+"/blog/")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := []Candidate{
+			{URL: server.URL + "/blog/feed.xml", Title: "Posts", Type: "application/rss+xml"},
+			{URL: server.URL + "/atom.xml", Title: "Atom", Type: "application/atom+xml"},
+		}
+		if !slices.Equal(candidates, want) {
+			t.Errorf("expected %v, got %v", want, candidates)
+		}
+	})
+
+	t.Run("probes common paths", func(t *testing.T) {
+		server := newServer(map[string]string{
+			"/":        `<html><head><title>Blog</title></head><body></body></html>`,
+			"/rss.xml": feed,
+		})
+		defer server.Close()
+
+		candidates, err := fetcher.Discover(context.Background(), server.URL+"/")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := []Candidate{{URL: server.URL + "/rss.xml", Title: "Blog"}}
+		if !slices.Equal(candidates, want) {
+			t.Errorf("expected %v, got %v", want, candidates)
+		}
+	})
+
+	t.Run("returns a feed url as is", func(t *testing.T) {
+		server := newServer(map[string]string{"/feed": feed})
+		defer server.Close()
+
+		candidates, err := fetcher.Discover(context.Background(), server.URL+"/feed")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := []Candidate{{URL: server.URL + "/feed", Title: "Blog", Type: "application/rss+xml"}}
+		if !slices.Equal(candidates, want) {
+			t.Errorf("expected %v, got %v", want, candidates)
+		}
+	})
+
+	t.Run("keeps the url of a feed behind a temporary redirect", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/feed":
+				http.Redirect(w, r, "/cdn/feed-v2", http.StatusFound)
+			case "/old-feed":
+				http.Redirect(w, r, "/feed", http.StatusMovedPermanently)
+			case "/cdn/feed-v2":
+				w.Header().Set("Content-Type", "application/rss+xml")
+				_, _ = w.Write([]byte(feed))
+			}
+		}))
+		defer server.Close()
+
+		tests := map[string]string{
+			"/feed":     server.URL + "/feed",
+			"/old-feed": server.URL + "/feed",
+		}
+		for path, want := range tests {
+			candidates, err := fetcher.Discover(context.Background(), server.URL+path)
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", path, err)
+			}
+			if len(candidates) != 1 || candidates[0].URL != want {
+				t.Errorf("%s: expected %q, got %v", path, want, candidates)
+			}
+		}
+	})
+
+	t.Run("skips probed paths that answer with a page", func(t *testing.T) {
+		page := `<html><head><title>Blog</title></head><body></body></html>`
+		server := newServer(map[string]string{"/": page, "/feed": page, "/atom.xml": feed})
+		defer server.Close()
+
+		candidates, err := fetcher.Discover(context.Background(), server.URL+"/")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := []Candidate{{URL: server.URL + "/atom.xml", Title: "Blog"}}
+		if !slices.Equal(candidates, want) {
+			t.Errorf("expected %v, got %v", want, candidates)
+		}
+	})
+
+	t.Run("reports pages without feeds", func(t *testing.T) {
+		server := newServer(map[string]string{"/": `<html><head></head><body></body></html>`})
+		defer server.Close()
+
+		if _, err := fetcher.Discover(context.Background(), server.URL+"/"); !errors.Is(err, ErrNoFeedsFound) {
+			t.Errorf("expected ErrNoFeedsFound, got %v", err)
+		}
+	})
+}
+
+func TestFetcher(t *testing.T) {
+	const body = `<rss version="2.0"><channel><title>Example</title></channel></rss>`
+
+	t.Run("sends the configured user agent", func(t *testing.T) {
+		var userAgent string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent = r.Header.Get("User-Agent")
+			_, _ = w.Write([]byte(body))
+		}))
+		defer server.Close()
+
+		fetcher := newTestFetcher(t, FetcherOptions{UserAgent: "gator-test/1.0"})
+		if _, err := fetcher.FetchFeed(context.Background(), server.URL, CacheHeaders{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if userAgent != "gator-test/1.0" {
+			t.Errorf("expected user agent %q, got %q", "gator-test/1.0", userAgent)
+		}
+	})
+
+	t.Run("retries 5xx and 429 responses", func(t *testing.T) {
+		statuses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts <= len(statuses) {
+				w.WriteHeader(statuses[attempts-1])
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+		defer server.Close()
+
+		fetcher := newTestFetcher(t, FetcherOptions{Retries: intPtr(2), RetryDelay: time.Millisecond})
+		feed, err := fetcher.FetchFeed(context.Background(), server.URL, CacheHeaders{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if feed.Channel.Title != "Example" {
+			t.Errorf("expected title %q, got %q", "Example", feed.Channel.Title)
+		}
+		if attempts != 3 {
+			t.Errorf("expected 3 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("gives up after the configured retries", func(t *testing.T) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		fetcher := newTestFetcher(t, FetcherOptions{Retries: intPtr(1), RetryDelay: time.Millisecond})
+		_, err := fetcher.FetchFeed(context.Background(), server.URL, CacheHeaders{})
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+			t.Fatalf("expected 502 StatusError, got %v", err)
+		}
+		if attempts != 2 {
+			t.Errorf("expected 2 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		fetcher := newTestFetcher(t, FetcherOptions{Retries: intPtr(3), RetryDelay: time.Millisecond})
+		if _, err := fetcher.FetchFeed(context.Background(), server.URL, CacheHeaders{}); err == nil {
+			t.Fatal("expected error for 404 response")
+		}
+		if attempts != 1 {
+			t.Errorf("expected 1 attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("stops following redirects after the limit", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/feed" {
+				_, _ = w.Write([]byte(body))
+				return
+			}
+			http.Redirect(w, r, "/feed", http.StatusMovedPermanently)
+		}))
+		defer server.Close()
+
+		if _, err := newTestFetcher(t, FetcherOptions{MaxRedirects: intPtr(1)}).FetchFeed(context.Background(), server.URL+"/old", CacheHeaders{}); err != nil {
+			t.Fatalf("expected redirect to be followed, got %v", err)
+		}
+		if _, err := newTestFetcher(t, FetcherOptions{MaxRedirects: intPtr(0)}).FetchFeed(context.Background(), server.URL+"/old", CacheHeaders{}); err == nil {
+			t.Fatal("expected error when redirects are disabled")
+		}
+	})
+
+	t.Run("times out hanging servers", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		fetcher := newTestFetcher(t, FetcherOptions{Timeout: 50 * time.Millisecond})
+		if _, err := fetcher.FetchFeed(context.Background(), server.URL, CacheHeaders{}); err == nil {
+			t.Fatal("expected timeout error")
+		}
+	})
+
+	t.Run("does not time out downloads", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-User-Agent", r.UserAgent())
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			_, _ = w.Write([]byte("episode"))
+		}))
+		defer server.Close()
+
+		fetcher := newTestFetcher(t, FetcherOptions{Timeout: 50 * time.Millisecond, UserAgent: "gator-test/1.0"})
+		req, err := http.NewRequestWithContext(context.Background(), "GET", server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := fetcher.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer resp.Body.Close()
+		if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "episode" {
+			t.Errorf("expected the whole body, got %q, %v", body, err)
+		}
+		if got := resp.Header.Get("X-User-Agent"); got != "gator-test/1.0" {
+			t.Errorf("expected the fetcher's user agent, got %q", got)
+		}
+	})
+
+	t.Run("selects defaults for unset options", func(t *testing.T) {
+		fetcher := newTestFetcher(t, FetcherOptions{})
+		if fetcher.client.Timeout != DefaultTimeout {
+			t.Errorf("expected timeout %v, got %v", DefaultTimeout, fetcher.client.Timeout)
+		}
+		if fetcher.retries != DefaultRetries {
+			t.Errorf("expected %d retries, got %d", DefaultRetries, fetcher.retries)
+		}
+		if fetcher.maxBytes != DefaultMaxBytes {
+			t.Errorf("expected size limit %d, got %d", DefaultMaxBytes, fetcher.maxBytes)
+		}
+
+		fetcher = newTestFetcher(t, FetcherOptions{Retries: intPtr(0)})
+		if fetcher.retries != 0 {
+			t.Errorf("expected retries to be disabled, got %d", fetcher.retries)
+		}
+	})
+
+	t.Run("bounds the wait for download response headers", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		req, _ := http.NewRequest("GET", server.URL+"/episode.mp3", nil)
+		if _, err := newTestFetcher(t, FetcherOptions{Timeout: 50 * time.Millisecond}).Do(req); err == nil {
+			t.Fatal("expected error for a server that does not answer")
+		}
+	})
+
+	t.Run("rejects invalid proxy urls", func(t *testing.T) {
+		if _, err := NewFetcher(FetcherOptions{ProxyURL: "://bad"}); err == nil {
+			t.Fatal("expected error for invalid proxy url")
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Run("defers the host after a Retry-After response", func(t *testing.T) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		fetcher := newTestFetcher(t, FetcherOptions{Retries: intPtr(3), RetryDelay: time.Millisecond})
+		_, err := fetcher.FetchFeed(context.Background(), server.URL+"/a", CacheHeaders{})
+		if got := RetryAfter(err); got != 2*time.Minute {
+			t.Fatalf("expected retry after 2m, got %v (%v)", got, err)
+		}
+		if attempts != 1 {
+			t.Errorf("expected 1 attempt, got %d", attempts)
+		}
+
+		// another feed on the same host is not requested
+		_, err = fetcher.FetchFeed(context.Background(), server.URL+"/b", CacheHeaders{})
+		var rateLimited *RateLimitedError
+		if !errors.As(err, &rateLimited) {
+			t.Fatalf("expected RateLimitedError, got %v", err)
+		}
+		if got := RetryAfter(err); got <= 0 || got > 2*time.Minute {
+			t.Errorf("expected remaining delay up to 2m, got %v", got)
+		}
+		if attempts != 1 {
+			t.Errorf("expected no new request, got %d attempts", attempts)
+		}
+	})
+
+	t.Run("does not wait for a turn after the context's deadline", func(t *testing.T) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Example</title></channel></rss>`))
+		}))
+		defer server.Close()
+
+		fetcher := newTestFetcher(t, FetcherOptions{HostRate: 0.5, HostBurst: 1})
+		if _, err := fetcher.FetchFeed(context.Background(), server.URL+"/a", CacheHeaders{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := fetcher.FetchFeed(ctx, server.URL+"/b", CacheHeaders{})
+		var rateLimited *RateLimitedError
+		if !errors.As(err, &rateLimited) {
+			t.Fatalf("expected RateLimitedError, got %v", err)
+		}
+		if got := RetryAfter(err); got <= 0 || got > 2*time.Second {
+			t.Errorf("expected the wait for the next turn, up to 2s, got %v", got)
+		}
+		if ctx.Err() != nil {
+			t.Errorf("expected to return before the deadline")
+		}
+		if attempts != 1 {
+			t.Errorf("expected no new request, got %d attempts", attempts)
+		}
+
+		// the unused turn is given back
+		u, _ := url.Parse(server.URL)
+		if wait, _ := fetcher.limiter.reserve(hostKey(u), time.Now()); wait > 2*time.Second {
+			t.Errorf("expected the turn to be given back, got wait %v", wait)
+		}
+	})
+
+	t.Run("parses seconds and HTTP dates", func(t *testing.T) {
+		now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		tests := []struct {
+			header string
+			want   time.Duration
+		}{
+			{"30", 30 * time.Second},
+			{"Mon, 01 Jan 2024 10:05:00 GMT", 5 * time.Minute},
+			{"Mon, 01 Jan 2024 09:00:00 GMT", 0},
+			{"soon", 0},
+			{"", 0},
+		}
+		for _, tt := range tests {
+			if got := parseRetryAfter(tt.header, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q): expected %v, got %v", tt.header, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("returns 0 for other errors", func(t *testing.T) {
+		if got := RetryAfter(&StatusError{StatusCode: http.StatusNotFound}); got != 0 {
+			t.Errorf("expected 0, got %v", got)
+		}
+	})
+}
+
+func TestHostLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := newHostLimiter(2, 2)
+
+	for i, want := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		wait, err := limiter.reserve("example.com", now)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if wait != want {
+			t.Errorf("request %d: expected wait %v, got %v", i, want, wait)
+		}
+	}
+
+	if wait, _ := limiter.reserve("other.example.com", now); wait != 0 {
+		t.Errorf("expected hosts to have separate buckets, got wait %v", wait)
+	}
+	if wait, _ := limiter.reserve("example.com", now.Add(10*time.Second)); wait != 0 {
+		t.Errorf("expected bucket to refill, got wait %v", wait)
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func newTestFetcher(t *testing.T, opts FetcherOptions) *Fetcher {
+	t.Helper()
+	fetcher, err := NewFetcher(opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return fetcher
+}
+
+func TestSchedule(t *testing.T) {
+	t.Run("reads ttl, syndication hints and skip lists", func(t *testing.T) {
+		data := []byte(`<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+  <channel>
+    <title>Scheduled</title>
+    <ttl>30</ttl>
+    <sy:updatePeriod>daily</sy:updatePeriod>
+    <sy:updateFrequency>4</sy:updateFrequency>
+    <skipHours><hour>0</hour><hour>24</hour><hour>bogus</hour></skipHours>
+    <skipDays><day>Saturday</day><day>Sunday</day></skipDays>
+  </channel>
+</rss>`)
+
+		feed, err := parseFeed(bytes.NewReader(data), "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		schedule := feed.Schedule()
+		if schedule.Interval != 6*time.Hour {
+			t.Errorf("expected the longer syndication interval, got %v", schedule.Interval)
+		}
+		if !slices.Equal(schedule.SkipHours, []int{0, 0}) {
+			t.Errorf("expected skip hours [0 0], got %v", schedule.SkipHours)
+		}
+		if !slices.Equal(schedule.SkipDays, []time.Weekday{time.Saturday, time.Sunday}) {
+			t.Errorf("expected weekend skip days, got %v", schedule.SkipDays)
+		}
+	})
+
+	t.Run("moves the next fetch past skipped hours and days", func(t *testing.T) {
+		schedule := Schedule{
+			SkipHours: []int{23, 0},
+			SkipDays:  []time.Weekday{time.Saturday},
+		}
+		// Friday 22:30 UTC plus one hour lands in a skipped hour, then on a skipped day
+		from := time.Date(2024, time.January, 5, 22, 30, 0, 0, time.UTC)
+
+		next := schedule.Next(from, time.Hour)
+		want := time.Date(2024, time.January, 7, 1, 0, 0, 0, time.UTC)
+		if !next.Equal(want) {
+			t.Errorf("expected %v, got %v", want, next)
+		}
+	})
+
+	t.Run("keeps the location of the start time", func(t *testing.T) {
+		schedule := Schedule{SkipHours: []int{15}}
+		newYork := time.FixedZone("EST", -5*60*60)
+		// 09:00 EST is 14:00 UTC, one hour later lands in the skipped 15:00 UTC hour
+		from := time.Date(2024, time.January, 5, 9, 0, 0, 0, newYork)
+
+		for interval, want := range map[time.Duration]time.Time{
+			time.Minute: time.Date(2024, time.January, 5, 9, 1, 0, 0, newYork),
+			time.Hour:   time.Date(2024, time.January, 5, 11, 0, 0, 0, newYork),
+		} {
+			next := schedule.Next(from, interval)
+			if !next.Equal(want) || next.Location() != newYork {
+				t.Errorf("interval %v: expected %v, got %v", interval, want, next)
+			}
+		}
+	})
+}
+
+func TestItemKey(t *testing.T) {
+	t.Run("prefers the guid", func(t *testing.T) {
+		item := Item{GUID: " tag:example.com,2024:1 ", Link: "https://example.com/1"}
+		if got := item.Key(); got != "tag:example.com,2024:1" {
+			t.Errorf("expected guid, got %q", got)
+		}
+	})
+
+	t.Run("falls back to the link", func(t *testing.T) {
+		item := Item{Link: "https://example.com/1"}
+		if got := item.Key(); got != "https://example.com/1" {
+			t.Errorf("expected link, got %q", got)
+		}
+	})
+
+	t.Run("falls back to a content hash", func(t *testing.T) {
+		item := Item{Title: "No link", Description: "Body"}
+		key := item.Key()
+		if !strings.HasPrefix(key, "sha256:") {
+			t.Fatalf("expected content hash, got %q", key)
+		}
+		if key != (Item{Title: "No link", Description: "Body"}).Key() {
+			t.Error("expected the same content to produce the same key")
+		}
+		if key == (Item{Title: "No linkBody"}).Key() {
+			t.Error("expected moving text between fields to change the key")
+		}
+	})
+
+	t.Run("parses guids from every format", func(t *testing.T) {
+		documents := map[string]string{
+			"rss":  `<rss><channel><item><guid isPermaLink="false">rss-1</guid></item></channel></rss>`,
+			"atom": `<feed xmlns="http://www.w3.org/2005/Atom"><entry><id>atom-1</id></entry></feed>`,
+			"rdf": `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">` +
+				`<item rdf:about="rdf-1"></item></rdf:RDF>`,
+			"json": `{"version": "https://jsonfeed.org/version/1.1", "items": [{"id": "json-1"}]}`,
+		}
+		for format, document := range documents {
+			feed, err := parseFeed(strings.NewReader(document), "")
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", format, err)
+			}
+			if len(feed.Channel.Item) != 1 || feed.Channel.Item[0].GUID != format+"-1" {
+				t.Errorf("%s: expected guid %q, got %+v", format, format+"-1", feed.Channel.Item)
+			}
+		}
+	})
+}
+
+func TestContentHash(t *testing.T) {
+	item := Item{
+		Title:       "Hello",
+		Description: "Summary",
+		PubDate:     "Mon, 01 Jan 2024 10:00:00 +0000",
+		Content:     "<p>Body</p>",
+		Author:      "alice@example.com",
+		Comments:    "https://example.com/1#comments",
+		Categories:  []string{"go", "feeds"},
+	}
+
+	t.Run("changes with every stored field", func(t *testing.T) {
+		edits := map[string]func(*Item){
+			"content":    func(i *Item) { i.Content = "<p>Edited</p>" },
+			"author":     func(i *Item) { i.Author = "bob@example.com" },
+			"comments":   func(i *Item) { i.Comments = "https://example.com/1/comments" },
+			"categories": func(i *Item) { i.Categories = []string{"go"} },
+		}
+		for field, edit := range edits {
+			edited := item
+			edit(&edited)
+			if edited.ContentHash() == item.ContentHash() {
+				t.Errorf("expected editing the %s to change the hash", field)
+			}
+		}
+	})
+
+	t.Run("ignores the order of the categories", func(t *testing.T) {
+		reordered := item
+		reordered.Categories = []string{"feeds", "go"}
+		if reordered.ContentHash() != item.ContentHash() {
+			t.Error("expected the same hash for reordered categories")
+		}
+	})
+
+	t.Run("does not change the key of items without guid or link", func(t *testing.T) {
+		edited := item
+		edited.Content = "<p>Edited</p>"
+		if edited.Key() != item.Key() {
+			t.Error("expected the key to only depend on the title, description and publish date")
+		}
+	})
+}
+
+func TestDurationSeconds(t *testing.T) {
+	tests := []struct {
+		duration string
+		want     int32
+	}{
+		{"3600", 3600},
+		{"05:30", 330},
+		{"1:02:03", 3723},
+		{"", 0},
+		{"1:2:3:4", 0},
+		{"about an hour", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.duration, func(t *testing.T) {
+			item := Item{Duration: tt.duration}
+			if got := item.DurationSeconds(); got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseOPML(t *testing.T) {
+	t.Run("reads nested folders as categories", func(t *testing.T) {
+		data := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Tech">
+      <outline text="Go">
+        <outline type="rss" text="Go Blog" title="The Go Blog" xmlUrl="https://go.dev/blog/feed.atom"/>
+      </outline>
+      <outline type="rss" text="Hacker News" xmlurl="https://news.ycombinator.com/rss" category="/news,links"/>
+    </outline>
+    <outline type="rss" text="Go Blog" xmlUrl="https://go.dev/blog/feed.atom"/>
+    <outline text="Empty folder"/>
+    <outline type="rss" text="Personal" xmlUrl="https://example.com/feed.xml"/>
+  </body>
+</opml>`
+		subscriptions, err := ParseOPML(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := []Subscription{
+			{URL: "https://go.dev/blog/feed.atom", Title: "The Go Blog", Categories: []string{"Tech/Go"}},
+			{URL: "https://news.ycombinator.com/rss", Title: "Hacker News", Categories: []string{"Tech", "news", "links"}},
+			{URL: "https://example.com/feed.xml", Title: "Personal"},
+		}
+		if len(subscriptions) != len(want) {
+			t.Fatalf("expected %d subscriptions, got %d: %v", len(want), len(subscriptions), subscriptions)
+		}
+		for i, sub := range subscriptions {
+			if sub.URL != want[i].URL || sub.Title != want[i].Title || !slices.Equal(sub.Categories, want[i].Categories) {
+				t.Errorf("expected %v, got %v", want[i], sub)
+			}
+		}
+	})
+
+	t.Run("transcodes the declared encoding", func(t *testing.T) {
+		data := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><opml><body>" +
+			"<outline text=\"Caf\xe9\" xmlUrl=\"https://example.com/feed\"/></body></opml>"
+		subscriptions, err := ParseOPML(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(subscriptions) != 1 || subscriptions[0].Title != "Café" {
+			t.Errorf("expected the title Café, got %v", subscriptions)
+		}
+	})
+
+	t.Run("rejects documents that are not opml", func(t *testing.T) {
+		for _, data := range []string{"", `<rss version="2.0"></rss>`, "not xml"} {
+			if _, err := ParseOPML(strings.NewReader(data)); err == nil {
+				t.Errorf("expected error for %q", data)
+			}
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package rss
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule holds the refresh hints published by a feed.
+type Schedule struct {
+	// Interval is the minimum time between fetches, from <ttl> or <sy:updatePeriod>/<sy:updateFrequency>.
+	Interval time.Duration
+	// SkipHours are the GMT hours during which the feed should not be fetched.
+	SkipHours []int
+	// SkipDays are the days on which the feed should not be fetched.
+	SkipDays []time.Weekday
+}
+
+// Schedule returns the refresh hints of the feed. When both ttl and the syndication module are present,
+// the longer interval wins.
+func (f *Feed) Schedule() Schedule {
+	var schedule Schedule
+	if ttl, err := strconv.Atoi(strings.TrimSpace(f.Channel.TTL)); err == nil && ttl > 0 {
+		schedule.Interval = time.Duration(ttl) * time.Minute
+	}
+	schedule.Interval = max(schedule.Interval, syndicationInterval(f.Channel.UpdatePeriod, f.Channel.UpdateFrequency))
+
+	for _, hour := range f.Channel.SkipHours {
+		if h, err := strconv.Atoi(strings.TrimSpace(hour)); err == nil && h >= 0 && h <= 24 {
+			// some publishers number hours 1-24
+			schedule.SkipHours = append(schedule.SkipHours, h%24)
+		}
+	}
+	for _, day := range f.Channel.SkipDays {
+		if d, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]; ok {
+			schedule.SkipDays = append(schedule.SkipDays, d)
+		}
+	}
+	return schedule
+}
+
+// Next returns the earliest time after from plus interval at which the feed may be fetched,
+// moving past skipped hours and days. The result is in from's location.
+func (s Schedule) Next(from time.Time, interval time.Duration) time.Time {
+	next := from.Add(interval)
+	// a week of hours covers every combination of skipped hours and days
+	for range 7 * 24 {
+		utc := next.UTC()
+		if !slices.Contains(s.SkipHours, utc.Hour()) && !slices.Contains(s.SkipDays, utc.Weekday()) {
+			break
+		}
+		next = utc.Truncate(time.Hour).Add(time.Hour)
+	}
+	return next.In(from.Location())
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+var updatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// syndicationInterval converts the RSS syndication module's updatePeriod and updateFrequency into an interval.
+func syndicationInterval(period, frequency string) time.Duration {
+	duration, ok := updatePeriods[strings.ToLower(strings.TrimSpace(period))]
+	if !ok {
+		return 0
+	}
+	times := 1
+	if n, err := strconv.Atoi(strings.TrimSpace(frequency)); err == nil && n > 0 {
+		times = n
+	}
+	return duration / time.Duration(times)
+}
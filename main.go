@@ -6,7 +6,6 @@ import (
 
 	"github.com/Nightails/gator/internal/cli"
 	"github.com/Nightails/gator/internal/config"
-	"github.com/Nightails/gator/internal/database"
 	_ "github.com/lib/pq"
 )
 
@@ -16,6 +15,5 @@ func main() {
 	if err != nil {
 		fmt.Printf("error: failed to open database: %v\n", err)
 	}
-	dbQueries := database.New(db)
-	cli.RunCli(&cfg, dbQueries)
+	cli.RunCli(&cfg, db)
 }
@@ -0,0 +1,41 @@
+-- name: UpsertEnclosures :exec
+-- Enclosures seen again are only updated when their metadata changed, so updated_at tracks actual changes.
+INSERT INTO enclosures(id, created_at, updated_at, post_id, url, length, mime_type, duration_seconds, image_url)
+SELECT
+    unnest(@ids::uuid[]),
+    @created_at::timestamp,
+    @created_at::timestamp,
+    unnest(@post_ids::uuid[]),
+    unnest(@urls::text[]),
+    NULLIF(unnest(@lengths::bigint[]), 0),
+    NULLIF(unnest(@mime_types::text[]), ''),
+    NULLIF(unnest(@durations::int[]), 0),
+    NULLIF(unnest(@image_urls::text[]), '')
+ON CONFLICT (post_id, url) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+    length = EXCLUDED.length,
+    mime_type = EXCLUDED.mime_type,
+    duration_seconds = EXCLUDED.duration_seconds,
+    image_url = EXCLUDED.image_url
+WHERE (enclosures.length, enclosures.mime_type, enclosures.duration_seconds, enclosures.image_url)
+    IS DISTINCT FROM (EXCLUDED.length, EXCLUDED.mime_type, EXCLUDED.duration_seconds, EXCLUDED.image_url);
+
+-- name: GetEnclosuresToDownload :many
+-- Enclosures of the posts in the feeds a user follows that have not been downloaded yet, oldest first.
+-- Pass an empty feed url to include every followed feed.
+SELECT enclosures.id, enclosures.created_at, enclosures.updated_at, enclosures.post_id, enclosures.url, enclosures.length, enclosures.mime_type, enclosures.duration_seconds, enclosures.image_url, enclosures.local_path, enclosures.downloaded_at, feeds.name AS feed_name, posts.title AS post_title
+FROM enclosures
+JOIN posts ON posts.id = enclosures.post_id
+JOIN feeds ON feeds.id = posts.feed_id
+JOIN feed_follows ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = @user_id
+  AND enclosures.local_path IS NULL
+  AND (@feed_url::text = '' OR feeds.url = @feed_url::text)
+ORDER BY posts.published_at;
+
+-- name: SetEnclosureDownloaded :exec
+UPDATE enclosures
+SET local_path = @local_path::text,
+    downloaded_at = @downloaded_at::timestamp,
+    updated_at = @downloaded_at::timestamp
+WHERE id = @id;
@@ -0,0 +1,9 @@
+-- name: AddFeedFollowCategories :exec
+INSERT INTO feed_follow_categories(user_id, feed_id, name)
+SELECT @user_id::uuid, @feed_id::uuid, unnest(@names::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: GetFeedFollowCategoriesForUser :many
+SELECT feed_id, name FROM feed_follow_categories
+WHERE user_id = $1
+ORDER BY name;
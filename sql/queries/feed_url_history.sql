@@ -0,0 +1,11 @@
+-- name: AddFeedURLHistory :exec
+-- Remembers a previous url of a feed so that it still resolves to the feed.
+INSERT INTO feed_url_history(id, created_at, feed_id, url)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (url) DO UPDATE
+SET feed_id = EXCLUDED.feed_id, created_at = EXCLUDED.created_at;
+
+-- name: GetFeedURLHistory :many
+SELECT * FROM feed_url_history
+WHERE feed_id = $1
+ORDER BY created_at;
@@ -7,15 +7,100 @@ RETURNING *;
 SELECT * FROM feeds;
 
 -- name: GetFeedByURL :one
+-- Also finds feeds that moved away from the url.
 SELECT * FROM feeds
-WHERE url = $1;
+WHERE feeds.url = $1
+   OR feeds.id = (SELECT feed_url_history.feed_id FROM feed_url_history WHERE feed_url_history.url = $1)
+ORDER BY feeds.url = $1 DESC
+LIMIT 1;
 
--- name: MarkFeedFetched :exec
+-- name: ReleaseFeedLease :exec
 UPDATE feeds
-SET last_fetched_at = $2, updated_at = $2
+SET lease_expires_at = NULL
 WHERE id = $1;
 
--- name: GetNextFeedToFetch :one
+-- name: ClaimNextFeedsToFetch :many
+-- Leases and due times are checked against the database clock, in UTC like the other scheduling times,
+-- so that aggregators on hosts with different clocks or time zones agree on them.
+UPDATE feeds
+SET lease_expires_at = (now() AT TIME ZONE 'UTC') + make_interval(secs => @lease_seconds::int)
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE disabled_at IS NULL
+      AND (next_fetch_at IS NULL OR next_fetch_at <= now() AT TIME ZONE 'UTC')
+      AND (lease_expires_at IS NULL OR lease_expires_at < now() AT TIME ZONE 'UTC')
+      AND (last_fetched_at IS NULL OR last_fetched_at < @fetched_before::timestamp)
+      AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+    ORDER BY last_fetched_at ASC NULLS FIRST
+    LIMIT @batch_size
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ClaimFeedByID :one
+-- Claims a single feed whether or not it is due. No row is returned while another aggregator holds its lease.
+UPDATE feeds
+SET lease_expires_at = (now() AT TIME ZONE 'UTC') + make_interval(secs => @lease_seconds::int)
+WHERE id = (
+    SELECT id FROM feeds
+    WHERE feeds.id = @id
+      AND (lease_expires_at IS NULL OR lease_expires_at < now() AT TIME ZONE 'UTC')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: SetFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3
+WHERE id = $1;
+
+-- name: RecordFeedFailure :exec
+-- A feed that is already disabled stays disabled with its reason, a NULL disabled_at leaves it enabled.
+-- Also marks the feed fetched and releases its lease, so that it is never claimed before its next fetch is scheduled.
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1, last_error = $2, last_error_at = $3, next_fetch_at = $4,
+    disabled_at = COALESCE(disabled_at, $5), disabled_reason = COALESCE(disabled_reason, $6),
+    last_fetched_at = $7, updated_at = $7, lease_expires_at = NULL
+WHERE id = $1;
+
+-- name: DeferFeedFetch :exec
+-- Pushes the next fetch out as asked by the server, without counting a failure. Releases the feed's lease.
+UPDATE feeds
+SET last_error = $2, last_error_at = $3, next_fetch_at = $4, last_fetched_at = $5, updated_at = $5, lease_expires_at = NULL
+WHERE id = $1;
+
+-- name: RecordFeedSuccess :exec
+-- Also marks the feed fetched and releases its lease, so that it is never claimed before its next fetch is scheduled.
+UPDATE feeds
+SET consecutive_failures = 0, next_fetch_at = $2, min_interval_seconds = $3, skip_hours = $5, skip_days = $6,
+    last_fetched_at = $4, updated_at = $4, lease_expires_at = NULL
+WHERE id = $1;
+
+-- name: GetBrokenFeeds :many
 SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
\ No newline at end of file
+WHERE disabled_at IS NOT NULL OR consecutive_failures > 0
+ORDER BY consecutive_failures DESC;
+
+-- name: EnableFeed :exec
+UPDATE feeds
+SET disabled_at = NULL, disabled_reason = NULL, consecutive_failures = 0, next_fetch_at = NULL, updated_at = $2
+WHERE id = $1;
+
+-- name: SetFeedIntervalOverride :exec
+UPDATE feeds
+SET interval_override_seconds = $2, next_fetch_at = $3, updated_at = $4
+WHERE id = $1;
+
+-- name: GetOrphanedFeeds :many
+SELECT * FROM feeds
+WHERE NOT EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id);
+
+-- name: DeleteOrphanedFeeds :many
+DELETE FROM feeds
+WHERE NOT EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+RETURNING *;
+
+-- name: UpdateFeedURL :exec
+UPDATE feeds
+SET url = $2, updated_at = $3
+WHERE id = $1;
@@ -0,0 +1,13 @@
+-- name: DeletePostCategories :exec
+DELETE FROM post_categories
+WHERE post_id = ANY(@post_ids::uuid[]);
+
+-- name: AddPostCategories :exec
+INSERT INTO post_categories(post_id, name)
+SELECT unnest(@post_ids::uuid[]), unnest(@names::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: GetPostCategories :many
+SELECT name FROM post_categories
+WHERE post_id = $1
+ORDER BY name;
@@ -1,6 +1,37 @@
--- name: CreatePost :one
-INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+-- name: UpsertPosts :many
+-- Inserts the posts of a feed in a single statement, updating the stored posts whose content changed.
+-- Only inserted and updated posts are returned. Posts stored before content hashes existed
+-- only get their hash filled in, without counting a revision.
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, author, comments_url, content, undated)
+SELECT
+    unnest(@ids::uuid[]),
+    @created_at::timestamp,
+    @created_at::timestamp,
+    unnest(@titles::text[]),
+    unnest(@urls::text[]),
+    unnest(@descriptions::text[]),
+    unnest(@published_ats::text[])::timestamp,
+    @feed_id::uuid,
+    unnest(@guids::text[]),
+    unnest(@content_hashes::text[]),
+    NULLIF(unnest(@authors::text[]), ''),
+    NULLIF(unnest(@comments_urls::text[]), ''),
+    NULLIF(unnest(@contents::text[]), ''),
+    unnest(@undated::bool[])
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    -- an undated post keeps the fetch time it was first stored with
+    published_at = CASE WHEN EXCLUDED.undated THEN posts.published_at ELSE EXCLUDED.published_at END,
+    undated = EXCLUDED.undated AND posts.undated,
+    author = EXCLUDED.author,
+    comments_url = EXCLUDED.comments_url,
+    content = EXCLUDED.content,
+    updated_at = EXCLUDED.updated_at,
+    content_hash = EXCLUDED.content_hash,
+    revisions = posts.revisions + CASE WHEN posts.content_hash IS NULL THEN 0 ELSE 1 END
+WHERE posts.content_hash IS DISTINCT FROM EXCLUDED.content_hash
 RETURNING *;
 
 -- name: GetPostsForUser :many
@@ -8,4 +39,20 @@ SELECT posts.* FROM posts
 INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 WHERE feed_follows.user_id = $1
 ORDER BY posts.published_at DESC
-LIMIT $2;
\ No newline at end of file
+LIMIT $2;
+
+-- name: RekeyLegacyPosts :exec
+-- Posts stored before guids existed got their url as guid. Gives them the key of the feed item with the same link,
+-- so that the item updates the post instead of being stored a second time.
+UPDATE posts
+SET guid = items.guid
+FROM (SELECT unnest(@urls::text[]) AS url, unnest(@guids::text[]) AS guid) AS items
+WHERE posts.feed_id = @feed_id::uuid
+  AND posts.guid = posts.url
+  AND posts.url = items.url
+  AND NOT EXISTS (SELECT 1 FROM posts AS taken WHERE taken.feed_id = posts.feed_id AND taken.guid = items.guid);
+
+-- name: GetPostIDsByGuids :many
+SELECT id, guid FROM posts
+WHERE feed_id = @feed_id::uuid
+  AND guid = ANY(@guids::text[]);
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN min_interval_seconds INTEGER NULL,
+ADD COLUMN interval_override_seconds INTEGER NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN min_interval_seconds,
+DROP COLUMN interval_override_seconds;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN content_hash TEXT NULL,
+ADD COLUMN revisions INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE posts
+DROP COLUMN content_hash,
+DROP COLUMN revisions;
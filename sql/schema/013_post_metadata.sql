@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN author TEXT NULL,
+ADD COLUMN comments_url TEXT NULL,
+ADD COLUMN content TEXT NULL;
+
+CREATE TABLE post_categories (
+    post_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    PRIMARY KEY (post_id, name),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE post_categories;
+
+ALTER TABLE posts
+DROP COLUMN author,
+DROP COLUMN comments_url,
+DROP COLUMN content;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE enclosures (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    post_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    length BIGINT NULL,
+    mime_type TEXT NULL,
+    duration_seconds INT NULL,
+    image_url TEXT NULL,
+    local_path TEXT NULL,
+    downloaded_at TIMESTAMP NULL,
+    UNIQUE (post_id, url),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE enclosures;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE feed_url_history (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    feed_id UUID NOT NULL,
+    url TEXT NOT NULL UNIQUE,
+    FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE CASCADE
+);
+
+ALTER TABLE feeds
+ADD COLUMN disabled_reason TEXT NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN disabled_reason;
+
+DROP TABLE feed_url_history;
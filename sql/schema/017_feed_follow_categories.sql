@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE feed_follow_categories (
+    user_id UUID NOT NULL,
+    feed_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    PRIMARY KEY (user_id, feed_id, name),
+    FOREIGN KEY (user_id, feed_id) REFERENCES feed_follows(user_id, feed_id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE feed_follow_categories;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Content hashes now cover the author, comments link, content and categories of a post.
+-- Posts without a hash are rewritten by their next fetch without counting a revision,
+-- which also fills the columns added by 013_post_metadata.sql for the posts stored before it.
+UPDATE posts SET content_hash = NULL;
+
+-- +goose Down
+-- The hashes are recomputed by the next fetch.
+SELECT 1;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- The <skipHours> (GMT hours) and <skipDays> (weekdays, 0 is Sunday) published by a feed, kept so that fetches
+-- answered 304 Not Modified still honor them.
+ALTER TABLE feeds
+ADD COLUMN skip_hours INTEGER[] NOT NULL DEFAULT '{}',
+ADD COLUMN skip_days INTEGER[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN skip_hours,
+DROP COLUMN skip_days;